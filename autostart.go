@@ -0,0 +1,537 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// autostartConf holds the commands Hyprland starts, relative to $HOME.
+const autostartConf = hyprConfDir + "/autostart.conf"
+
+// autostartLine is an exec-once or exec line, commented out or not.
+var autostartLine = regexp.MustCompile(`^\s*(#\s*)?(exec-once|exec)\s*=\s*(.*?)\s*$`)
+
+// autostartEntry is a command of autostart.conf.
+type autostartEntry struct {
+	// Line is the exec line, First the first line of the comments above it
+	Line  int
+	First int
+	// Kind is exec-once, or exec for the commands run on every reload
+	Kind        string
+	Command     string
+	Description string
+	Enabled     bool
+	Issues      []string
+}
+
+// parseAutostart returns the entries of autostart.conf. An entry is
+// described by the comments right above it, such as "# Load Notification
+// Daemon" for swaync.
+func parseAutostart(lines []string) []autostartEntry {
+	var entries []autostartEntry
+	for i, line := range lines {
+		match := autostartLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		entry := autostartEntry{Line: i, First: i, Kind: match[2], Command: match[3], Enabled: match[1] == ""}
+		var comments []string
+		for j := i - 1; j >= 0; j-- {
+			trimmed := strings.TrimSpace(lines[j])
+			if !strings.HasPrefix(trimmed, "#") || autostartLine.MatchString(trimmed) {
+				break
+			}
+			comments = append([]string{strings.TrimSpace(strings.TrimLeft(trimmed, "#"))}, comments...)
+			entry.First = j
+		}
+		entry.Description = strings.TrimSpace(strings.Join(comments, " "))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// autostartIssues returns what a command needs that won't be there: the
+// scripts under $HOME it runs, which exists reports on, and the packages of
+// its commands that are neither installed nor planned.
+func autostartIssues(command string, exists func(rel string) bool, planned map[string]bool) []string {
+	var issues []string
+	for _, script := range scriptPaths(command) {
+		if !exists(script) {
+			issues = append(issues, fmt.Sprintf("runs %s, which doesn't exist", displayPath(script)))
+		}
+	}
+	for _, name := range execCommands(command) {
+		if pkg, steps, missing := missingPackage(name, planned); missing {
+			issues = append(issues, fmt.Sprintf("runs %s, but %s is neither installed nor selected (%s)", name, pkg, strings.Join(steps, ", ")))
+		}
+	}
+	return issues
+}
+
+// toggleAutostart comments the entry's exec line out, or back in.
+func toggleAutostart(lines []string, entry autostartEntry) {
+	line := lines[entry.Line]
+	if entry.Enabled {
+		lines[entry.Line] = "# " + line
+	} else {
+		lines[entry.Line] = strings.TrimLeft(strings.TrimSpace(line), "# ")
+	}
+}
+
+// addAutostart appends an exec-once entry, after a blank line.
+func addAutostart(lines []string, command, description string) []string {
+	// Keep the final newline, if any, at the end
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	added := append([]string{}, lines[:end]...)
+	if end > 0 {
+		added = append(added, "")
+	}
+	if description != "" {
+		added = append(added, "# "+description)
+	}
+	added = append(added, "exec-once = "+command)
+	added = append(added, lines[end:]...)
+	if len(lines[end:]) == 0 {
+		added = append(added, "")
+	}
+	return added
+}
+
+// removeAutostart deletes an entry with its comments and the blank line
+// before them.
+func removeAutostart(lines []string, entry autostartEntry) []string {
+	first := entry.First
+	if first > 0 && strings.TrimSpace(lines[first-1]) == "" {
+		first--
+	}
+	return append(lines[:first:first], lines[entry.Line+1:]...)
+}
+
+// autostartEdits are the changes made to the checkout's autostart.conf,
+// which the profile keeps, by command.
+type autostartEdits struct {
+	// Enabled holds whether the commands run, where the checkout differs
+	Enabled map[string]bool     `json:"enabled,omitempty"`
+	Removed []string            `json:"removed,omitempty"`
+	Added   []autostartAddition `json:"added,omitempty"`
+}
+
+type autostartAddition struct {
+	Command     string `json:"command"`
+	Description string `json:"description,omitempty"`
+}
+
+// diffAutostart returns the changes turning the shipped entries into the
+// edited ones, or nil when there are none.
+func diffAutostart(shipped, edited []autostartEntry) *autostartEdits {
+	edits := autostartEdits{Enabled: make(map[string]bool)}
+	before := make(map[string]autostartEntry)
+	for _, entry := range shipped {
+		before[entry.Command] = entry
+	}
+	kept := make(map[string]bool)
+	for _, entry := range edited {
+		kept[entry.Command] = true
+		old, ok := before[entry.Command]
+		if !ok {
+			edits.Added = append(edits.Added, autostartAddition{Command: entry.Command, Description: entry.Description})
+		}
+		if !ok && !entry.Enabled || ok && old.Enabled != entry.Enabled {
+			edits.Enabled[entry.Command] = entry.Enabled
+		}
+	}
+	for _, entry := range shipped {
+		if !kept[entry.Command] {
+			edits.Removed = append(edits.Removed, entry.Command)
+		}
+	}
+	if len(edits.Enabled) == 0 && len(edits.Removed) == 0 && len(edits.Added) == 0 {
+		return nil
+	}
+	return &edits
+}
+
+// apply makes the changes to the lines of autostart.conf. Commands the
+// checkout no longer has are left alone.
+func (e autostartEdits) apply(lines []string) []string {
+	for _, command := range e.Removed {
+		for _, entry := range parseAutostart(lines) {
+			if entry.Command == command {
+				lines = removeAutostart(lines, entry)
+				break
+			}
+		}
+	}
+	for _, added := range e.Added {
+		if !slices.ContainsFunc(parseAutostart(lines), func(entry autostartEntry) bool { return entry.Command == added.Command }) {
+			lines = addAutostart(lines, added.Command, added.Description)
+		}
+	}
+	for _, entry := range parseAutostart(lines) {
+		if enabled, ok := e.Enabled[entry.Command]; ok && enabled != entry.Enabled {
+			toggleAutostart(lines, entry)
+		}
+	}
+	return lines
+}
+
+// applyAutostart makes the changes the profile keeps to the shipped
+// autostart.conf.
+func (p profile) applyAutostart(file *dotfile) error {
+	if file.Path != autostartConf || p.Autostart == nil {
+		return nil
+	}
+	base, err := file.content()
+	if err != nil {
+		return err
+	}
+	file.Rendered = []byte(strings.Join(p.Autostart.apply(strings.Split(string(base), "\n")), "\n"))
+	return nil
+}
+
+// autostartForm enables, disables, adds and removes the commands of
+// autostart.conf. The file is edited as lines, so its banners and comments
+// stay as they are.
+type autostartForm struct {
+	// path is the file edited, shown is how it is shown. Without a path
+	// the changes to shipped are saved to the profile instead.
+	path    string
+	shown   string
+	shipped []autostartEntry
+	mode    os.FileMode
+	lines   []string
+	entries []autostartEntry
+	exists  func(rel string) bool
+	planned map[string]bool
+
+	cursor int
+	offset int
+	// adding is the field being typed in for a new entry: the command,
+	// then its description
+	adding  int
+	command string
+	input   string
+	changed bool
+	message string
+	err     error
+}
+
+// newAutostartForm loads the autostart.conf at path. Scripts are looked for
+// below the roots, in order.
+func newAutostartForm(path, shown string, roots []string, planned []string) (autostartForm, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return autostartForm{}, err
+	}
+	f := loadAutostartForm(data, shown, roots, planned)
+	f.path = path
+	if info, err := os.Stat(path); err == nil {
+		f.mode = info.Mode().Perm()
+	}
+	return f, nil
+}
+
+// loadAutostartForm edits the changes the profile keeps to the shipped
+// autostart.conf, starting from data.
+func loadAutostartForm(data []byte, shown string, roots []string, planned []string) autostartForm {
+	f := autostartForm{shown: shown, mode: 0644, planned: make(map[string]bool)}
+	f.exists = func(rel string) bool {
+		for _, root := range roots {
+			if _, err := os.Stat(filepath.Join(root, rel)); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	for _, pkg := range planned {
+		f.planned[pkg] = true
+	}
+	f.lines = strings.Split(string(data), "\n")
+	f.parse()
+	return f
+}
+
+// parse finds the entries again after the lines changed.
+func (f *autostartForm) parse() {
+	f.entries = parseAutostart(f.lines)
+	for i := range f.entries {
+		f.entries[i].Issues = autostartIssues(f.entries[i].Command, f.exists, f.planned)
+	}
+	f.cursor = max(min(f.cursor, len(f.entries)-1), 0)
+}
+
+// toggle comments the entry's exec line out, or back in.
+func (f *autostartForm) toggle(entry autostartEntry) {
+	toggleAutostart(f.lines, entry)
+	f.changed = true
+	f.parse()
+}
+
+// add appends an exec-once entry.
+func (f *autostartForm) add(command, description string) {
+	f.lines = addAutostart(f.lines, command, description)
+	f.changed = true
+	f.parse()
+	f.cursor = len(f.entries) - 1
+}
+
+// remove deletes an entry with its comments.
+func (f *autostartForm) remove(entry autostartEntry) {
+	f.lines = removeAutostart(f.lines, entry)
+	f.changed = true
+	f.parse()
+}
+
+// update handles keys on the autostart screen. It returns done when the
+// screen is left, after saving the changes.
+func (f autostartForm) update(msg tea.KeyMsg, page int) (autostartForm, bool, tea.Cmd) {
+	if f.adding > 0 {
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return f, true, tea.Quit
+		case tea.KeyEsc:
+			f.adding = 0
+		case tea.KeyEnter:
+			value := strings.TrimSpace(f.input)
+			switch {
+			case f.adding == 1 && value == "":
+				f.err = fmt.Errorf("the command can't be empty")
+			case f.adding == 1:
+				f.command, f.input, f.adding, f.err = value, "", 2, nil
+			default:
+				f.add(f.command, value)
+				f.adding = 0
+			}
+		case tea.KeyBackspace:
+			if runes := []rune(f.input); len(runes) > 0 {
+				f.input = string(runes[:len(runes)-1])
+			}
+		case tea.KeySpace:
+			f.input += " "
+		case tea.KeyRunes:
+			f.input += string(msg.Runes)
+		}
+		return f, false, nil
+	}
+
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return f, true, tea.Quit
+	case "up", "k":
+		f.cursor = max(f.cursor-1, 0)
+	case "down", "j":
+		f.cursor = max(min(f.cursor+1, len(f.entries)-1), 0)
+	case " ", "space", "enter":
+		if len(f.entries) > 0 {
+			f.toggle(f.entries[f.cursor])
+		}
+	case "n":
+		f.adding, f.input, f.message, f.err = 1, "", "", nil
+	case "x":
+		if len(f.entries) > 0 {
+			f.remove(f.entries[f.cursor])
+		}
+	case "s":
+		f.message, f.err = f.save()
+	case "esc":
+		if f.message, f.err = f.save(); f.err == nil {
+			return f, true, nil
+		}
+	}
+	if f.cursor < f.offset {
+		f.offset = f.cursor
+	} else if f.cursor >= f.offset+page {
+		f.offset = f.cursor - page + 1
+	}
+	return f, false, nil
+}
+
+// save writes autostart.conf, or saves the changes to the profile, if it
+// was changed.
+func (f *autostartForm) save() (string, error) {
+	if !f.changed {
+		return "", nil
+	}
+	if f.path == "" {
+		prof, err := loadProfile()
+		if err != nil {
+			return "", err
+		}
+		prof.Autostart = diffAutostart(f.shipped, f.entries)
+		if err := prof.save(); err != nil {
+			return "", err
+		}
+		f.changed = false
+		return "Saved to the profile, autostart.conf is written with the dotfiles", nil
+	}
+	if err := writeFileAtomic(f.path, []byte(strings.Join(f.lines, "\n")), f.mode); err != nil {
+		return "", err
+	}
+	f.changed = false
+	return "✅ Saved " + f.shown + ", exec-once commands start on the next login", nil
+}
+
+func (f autostartForm) view(page int) string {
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("🚀 Autostart"))
+	result.WriteString("\n")
+	result.WriteString(descriptionStyle.Render(f.shown))
+	result.WriteString("\n\n")
+
+	if len(f.entries) == 0 {
+		result.WriteString("No exec-once line found.\n")
+	}
+	end := min(f.offset+page, len(f.entries))
+	for i := f.offset; i < end; i++ {
+		entry := f.entries[i]
+		box := "☑"
+		if !entry.Enabled {
+			box = "☐"
+		}
+		description := entry.Description
+		if entry.Kind == "exec" {
+			description = strings.TrimSpace(description + " (on every reload)")
+		}
+		line := fmt.Sprintf("%s %-44s %s", box, entry.Command, description)
+		if len(entry.Issues) > 0 {
+			line += "  ⚠"
+		}
+		switch {
+		case i == f.cursor:
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		case len(entry.Issues) > 0:
+			result.WriteString(warningStyle.Render("  " + line))
+		default:
+			result.WriteString(unselectedStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	if f.cursor < len(f.entries) {
+		entry := f.entries[f.cursor]
+		for _, issue := range entry.Issues {
+			result.WriteString("\n")
+			result.WriteString(warningStyle.Render("⚠ " + issue))
+		}
+		if len(entry.Issues) > 0 {
+			result.WriteString("\n")
+		}
+	}
+
+	if f.adding > 0 {
+		label := "Command"
+		if f.adding == 2 {
+			label = "Description of " + f.command
+		}
+		result.WriteString(fmt.Sprintf("\n%s: %s█\n", label, f.input))
+	}
+	if f.err != nil {
+		result.WriteString("\n")
+		result.WriteString(errorStyle.Render(f.err.Error()))
+		result.WriteString("\n")
+	} else if f.message != "" {
+		result.WriteString("\n")
+		result.WriteString(successStyle.Render(f.message))
+		result.WriteString("\n")
+	}
+
+	if f.adding > 0 {
+		result.WriteString("\nType the value, ENTER to keep it, ESC to cancel")
+	} else {
+		result.WriteString("\nUse ↑↓ to navigate, SPACE to enable or disable, 'n' to add a command, 'x' to remove one, 's' to save, ESC to save and go back")
+	}
+	return result.String()
+}
+
+// updateAutostartForm handles keys on the autostart screen of the dotfiles
+// review, which rescans the dotfiles with the changes saved to the profile.
+func (m model) updateAutostartForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	form, done, cmd := m.autostart.update(msg, m.listHeight())
+	m.autostart = form
+	if done && cmd == nil {
+		m.editingAutostart = false
+		m.review.profile.Autostart = diffAutostart(form.shipped, form.entries)
+		m.review = m.review.rescan(m.review.mode)
+	}
+	return m, cmd
+}
+
+// autostartModel is the autostart screen on its own.
+type autostartModel struct {
+	form   autostartForm
+	height int
+}
+
+func (m autostartModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m autostartModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		form, done, _ := m.form.update(msg, m.listHeight())
+		m.form = form
+		if done {
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m autostartModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-10, 5)
+}
+
+func (m autostartModel) View() string {
+	return m.form.view(m.listHeight())
+}
+
+// autostartCommand implements `dotfiles-installer autostart`, which edits
+// the autostart.conf in $HOME or, with --dotfiles, the one of the checkout.
+func autostartCommand(args []string) error {
+	dotfiles := false
+	switch {
+	case len(args) == 1 && args[0] == "--dotfiles":
+		dotfiles = true
+	case len(args) > 0:
+		return fmt.Errorf("usage: dotfiles-installer autostart [--dotfiles]")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	path, shown, roots := filepath.Join(home, autostartConf), "~/"+autostartConf, []string{home}
+	if dotfiles {
+		source, err := filepath.Abs(dotfilesSourceDir)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(source); err != nil {
+			return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+		}
+		path, shown, roots = filepath.Join(source, autostartConf), filepath.Join(dotfilesSourceDir, autostartConf), []string{source, home}
+	}
+
+	form, err := newAutostartForm(path, shown, roots, nil)
+	if err != nil {
+		return err
+	}
+	p := tea.NewProgram(autostartModel{form: form}, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
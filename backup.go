@@ -0,0 +1,402 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	backupManifestName = "manifest.json"
+	// backupHomeDir holds the copies of replaced files below the backup
+	// directory, laid out like $HOME.
+	backupHomeDir = "home"
+)
+
+// Reasons recorded in the backup manifest.
+const (
+	reasonReplaced = "replaced by dotfiles"
+	reasonCreated  = "created by dotfiles"
+	reasonLinked   = "linked by dotfiles"
+)
+
+// backupEntry records a file in $HOME the installer wrote, and what was
+// there before.
+type backupEntry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	// Backup is relative to the backup directory and empty when the file
+	// did not exist
+	Backup string `json:"backup,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Mode   string `json:"mode,omitempty"`
+	// Link is set instead of Backup when the original was a symlink
+	Link string `json:"link,omitempty"`
+	// Installed is the hash of what the installer wrote, used to tell
+	// whether the file changed since
+	Installed string `json:"installed_sha256,omitempty"`
+	// LinkedTo is set when the installer put a symlink there instead
+	LinkedTo string `json:"linked_to,omitempty"`
+	Restored bool   `json:"restored,omitempty"`
+}
+
+// backupManifest lists every file a run wrote to $HOME.
+type backupManifest struct {
+	Home    string        `json:"home"`
+	Entries []backupEntry `json:"entries"`
+}
+
+// dotfileBackup keeps the originals of the files a run replaces.
+type dotfileBackup struct {
+	dir      string
+	manifest backupManifest
+}
+
+func newDotfileBackup(run *runState, home string) *dotfileBackup {
+	return &dotfileBackup{
+		dir:      run.backupDir(),
+		manifest: backupManifest{Home: home, Entries: []backupEntry{}},
+	}
+}
+
+// loadDotfileBackup reads the backup manifest of the run in dir.
+func loadDotfileBackup(dir string) (*dotfileBackup, error) {
+	b := &dotfileBackup{dir: filepath.Join(dir, backupDirName)}
+	data, err := os.ReadFile(filepath.Join(b.dir, backupManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("reading backup manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &b.manifest); err != nil {
+		return nil, fmt.Errorf("parsing backup manifest: %w", err)
+	}
+	return b, nil
+}
+
+// preserve copies whatever is at path into the backup before it is
+// overwritten and returns the manifest entry for it.
+func (b *dotfileBackup) preserve(path string) (backupEntry, error) {
+	entry := backupEntry{Path: path, Reason: reasonCreated}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return entry, nil
+	}
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Reason = reasonReplaced
+	entry.Mode = fmt.Sprintf("%04o", info.Mode().Perm())
+	if info.Mode()&fs.ModeSymlink != 0 {
+		entry.Link, err = os.Readlink(path)
+		return entry, err
+	}
+	if !info.Mode().IsRegular() {
+		return entry, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return entry, err
+	}
+	rel, err := filepath.Rel(b.manifest.Home, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return entry, fmt.Errorf("%s is outside of %s", path, b.manifest.Home)
+	}
+
+	entry.Backup = filepath.Join(backupHomeDir, rel)
+	entry.SHA256 = sha256Hex(content)
+	dest := filepath.Join(b.dir, entry.Backup)
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return entry, err
+	}
+	return entry, os.WriteFile(dest, content, 0600)
+}
+
+// add records an entry once the file has been written. The manifest is
+// saved every time so that an interrupted run can still be restored.
+func (b *dotfileBackup) add(entry backupEntry) error {
+	b.manifest.Entries = append(b.manifest.Entries, entry)
+	return b.save()
+}
+
+func (b *dotfileBackup) save() error {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return fmt.Errorf("creating backup directory: %w", err)
+	}
+	data, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding backup manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(b.dir, backupManifestName), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("writing backup manifest: %w", err)
+	}
+	return nil
+}
+
+// modified reports whether the file at the entry's path changed since the
+// installer wrote it.
+func (e backupEntry) modified() bool {
+	if e.LinkedTo != "" {
+		dest, err := os.Readlink(e.Path)
+		return err != nil || dest != e.LinkedTo
+	}
+	content, err := os.ReadFile(e.Path)
+	if err != nil {
+		return true
+	}
+	return sha256Hex(content) != e.Installed
+}
+
+// restore puts back what was at the entry's path before the installer
+// wrote it, removing files the installer created.
+func (b *dotfileBackup) restore(i int) error {
+	entry := b.manifest.Entries[i]
+
+	switch {
+	case entry.Link != "":
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Symlink(entry.Link, entry.Path); err != nil {
+			return err
+		}
+	case entry.Backup != "":
+		content, err := os.ReadFile(filepath.Join(b.dir, entry.Backup))
+		if err != nil {
+			return err
+		}
+		if got := sha256Hex(content); got != entry.SHA256 {
+			return fmt.Errorf("backup of %s is corrupted: expected %s, got %s", entry.Path, entry.SHA256, got)
+		}
+		mode, err := strconv.ParseUint(entry.Mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid mode %q for %s", entry.Mode, entry.Path)
+		}
+		if err := writeFileAtomic(entry.Path, content, fs.FileMode(mode)); err != nil {
+			return err
+		}
+	default:
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		// Also remove the directories the installer created for the file
+		for dir := filepath.Dir(entry.Path); strings.HasPrefix(dir, b.manifest.Home+string(filepath.Separator)); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	b.manifest.Entries[i].Restored = true
+	return b.save()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// restoreModel rolls the files of a run back, all of them or a selection.
+type restoreModel struct {
+	run      string
+	backup   *dotfileBackup
+	selected map[int]bool
+	cursor   int
+	offset   int
+	height   int
+	results  []string
+	done     bool
+}
+
+func (m restoreModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m restoreModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		if m.done {
+			return m, tea.Quit
+		}
+
+		entries := m.backup.manifest.Entries
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+		case "up", "k":
+			m.cursor = max(m.cursor-1, 0)
+		case "down", "j":
+			m.cursor = max(min(m.cursor+1, len(entries)-1), 0)
+		case "space", " ":
+			if len(entries) > 0 {
+				m.selected[m.cursor] = !m.selected[m.cursor]
+			}
+		case "a":
+			// Select everything, or nothing when everything is selected
+			all := len(m.selected) == len(entries)
+			m.selected = make(map[int]bool)
+			if !all {
+				for i := range entries {
+					m.selected[i] = true
+				}
+			}
+		case "enter":
+			m.restoreSelected()
+			m.done = true
+		}
+
+		for i, selected := range m.selected {
+			if !selected {
+				delete(m.selected, i)
+			}
+		}
+		page := m.listHeight()
+		if m.cursor < m.offset {
+			m.offset = m.cursor
+		} else if m.cursor >= m.offset+page {
+			m.offset = m.cursor - page + 1
+		}
+	}
+	return m, nil
+}
+
+// restoreSelected restores the selected entries, newest first so that a
+// file written twice ends up with its oldest content.
+func (m *restoreModel) restoreSelected() {
+	entries := m.backup.manifest.Entries
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !m.selected[i] {
+			continue
+		}
+		if err := m.backup.restore(i); err != nil {
+			m.results = append(m.results, errorStyle.Render(fmt.Sprintf("❌ %s: %v", entries[i].Path, err)))
+		} else if entries[i].Backup == "" && entries[i].Link == "" {
+			m.results = append(m.results, successStyle.Render("✅ Removed "+entries[i].Path))
+		} else {
+			m.results = append(m.results, successStyle.Render("✅ Restored "+entries[i].Path))
+		}
+	}
+}
+
+func (m restoreModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-10, 5)
+}
+
+func (m restoreModel) View() string {
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("⏪ Restore run " + m.run))
+	result.WriteString("\n")
+
+	if m.done {
+		if len(m.results) == 0 {
+			result.WriteString("Nothing was selected.\n")
+		}
+		for _, line := range m.results {
+			result.WriteString(line)
+			result.WriteString("\n")
+		}
+		result.WriteString("\nPress any key to exit...")
+		return result.String()
+	}
+
+	entries := m.backup.manifest.Entries
+	if len(entries) == 0 {
+		result.WriteString(descriptionStyle.Render("This run did not write any dotfiles."))
+		result.WriteString("\n\nPress 'q' to quit")
+		return result.String()
+	}
+
+	end := min(m.offset+m.listHeight(), len(entries))
+	for i := m.offset; i < end; i++ {
+		entry := entries[i]
+		checkbox := "[ ]"
+		if m.selected[i] {
+			checkbox = "[✓]"
+		}
+		line := fmt.Sprintf("%s %s  %s", checkbox, entry.Path, entry.Reason)
+		if entry.Restored {
+			line += ", restored"
+		} else if entry.modified() {
+			line += ", modified since"
+		}
+
+		switch {
+		case i == m.cursor:
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		case entry.Restored:
+			result.WriteString(unselectedStyle.Render("  " + line))
+		case m.selected[i]:
+			result.WriteString(successStyle.Render("  " + line))
+		default:
+			result.WriteString(unselectedStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	result.WriteString(fmt.Sprintf("\n%d of %d selected. Replaced files get their backup back, created files are removed.\n", len(m.selected), len(entries)))
+	result.WriteString("Use ↑↓ to navigate, SPACE to toggle, 'a' to toggle all, ENTER to restore, 'q' to quit")
+	return result.String()
+}
+
+// latestBackupRun returns the directory of the most recent run with a backup
+// manifest. Runs without the Dotfiles step have none.
+func latestBackupRun() (string, error) {
+	dir, err := runsDir()
+	if err != nil {
+		return "", err
+	}
+	ids, err := runIDs()
+	if err != nil {
+		return "", err
+	}
+	for i := len(ids) - 1; i >= 0; i-- {
+		runDir := filepath.Join(dir, ids[i])
+		if _, err := os.Stat(filepath.Join(runDir, backupDirName, backupManifestName)); err == nil {
+			return runDir, nil
+		}
+	}
+	return "", fmt.Errorf("no installer run in %s has backed up dotfiles, nothing to restore", dir)
+}
+
+// restoreCommand implements `dotfiles-installer restore [run]`.
+func restoreCommand(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: dotfiles-installer restore [run]")
+	}
+	var dir string
+	var err error
+	if len(args) == 1 {
+		dir, err = findRun(args[0])
+	} else {
+		dir, err = latestBackupRun()
+	}
+	if err != nil {
+		return err
+	}
+	backup, err := loadDotfileBackup(dir)
+	if err != nil {
+		return err
+	}
+
+	p := tea.NewProgram(restoreModel{
+		run:      filepath.Base(dir),
+		backup:   backup,
+		selected: make(map[int]bool),
+	}, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// commandPackages maps the commands binds run to their package, where the
+// names differ.
+var commandPackages = map[string]string{
+	"spf":             "superfile",
+	"rofi":            "rofi-wayland",
+	"code":            "visual-studio-code-bin",
+	"zen-browser":     "zen-browser-bin",
+	"vesktop":         "vesktop-bin",
+	"spotube":         "spotube-bin",
+	"obs":             "obs-studio",
+	"libreoffice":     "libreoffice-fresh",
+	"nvim":            "neovim",
+	"hyprctl":         "hyprland",
+	"swaync-client":   "swaync",
+	"wpctl":           "wireplumber",
+	"blueman-manager": "blueman",
+	"bluetoothctl":    "bluez-utils",
+
+	"/usr/lib/polkit-gnome/polkit-gnome-authentication-agent-1": "polkit-gnome",
+}
+
+// terminalCommands run the command given as their arguments, as in
+// `kitty spf`.
+var terminalCommands = map[string]bool{"kitty": true, "alacritty": true, "foot": true, "wezterm": true}
+
+// packageSteps returns the steps installing a package, sorted.
+func packageSteps(pkg string) []string {
+	var steps []string
+	for function, packages := range stepPackages {
+		for _, p := range append(packages.Repo, packages.AUR...) {
+			if p == pkg {
+				steps = append(steps, function)
+				break
+			}
+		}
+	}
+	sort.Strings(steps)
+	return steps
+}
+
+// shellSeparator splits a command line into the commands it runs.
+var shellSeparator = regexp.MustCompile(`\|\||&&|[|;&]|\$\(|` + "`")
+
+// execCommands returns the commands an exec bind runs: the first word of
+// each part of the command line, and what a terminal is asked to run.
+func execCommands(command string) []string {
+	var commands []string
+	for _, part := range shellSeparator.Split(command, -1) {
+		words := strings.Fields(part)
+		// Skip variable assignments such as LANG=C
+		for len(words) > 0 && strings.Contains(words[0], "=") {
+			words = words[1:]
+		}
+		// What follows $(...) is arguments
+		if len(words) == 0 || strings.HasPrefix(words[0], "-") {
+			continue
+		}
+		commands = append(commands, strings.Trim(words[0], `"'()`))
+		if !terminalCommands[words[0]] {
+			continue
+		}
+		rest := words[1:]
+		if i := slices.Index(rest, "-e"); i >= 0 && i+1 < len(rest) {
+			commands = append(commands, rest[i+1])
+		} else if len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+			commands = append(commands, rest[0])
+		}
+	}
+	return commands
+}
+
+// scriptPaths returns the shell and Python scripts under $HOME a command
+// line runs, relative to $HOME.
+func scriptPaths(command string) []string {
+	var scripts []string
+	for _, word := range strings.Fields(command) {
+		word = strings.Trim(word, `"'()`+"`")
+		rel, ok := strings.CutPrefix(word, "~/")
+		if !ok {
+			rel, ok = strings.CutPrefix(word, "$HOME/")
+		}
+		if ok && (strings.HasSuffix(rel, ".sh") || strings.HasSuffix(rel, ".py")) {
+			scripts = append(scripts, rel)
+		}
+	}
+	return scripts
+}
+
+// comboKey identifies the key combination of a bind, whatever the order and
+// case of its modifiers. Mouse binds don't clash with key binds.
+func comboKey(bind hyprBind) string {
+	mods := strings.Fields(strings.ToUpper(strings.ReplaceAll(bind.Mods, "_", " ")))
+	sort.Strings(mods)
+	key := strings.Join(mods, " ") + "+" + strings.ToUpper(bind.Key)
+	if bind.Kind == "bindm" {
+		key = "mouse " + key
+	}
+	return key
+}
+
+// checkBind reports a bind whose keys are already bound, and the scripts and
+// commands it runs that won't be there.
+func (c *hyprChecker) checkBind(bind hyprBind) {
+	issue := func(warning bool, format string, args ...any) {
+		c.issues = append(c.issues, hyprIssue{File: bind.File, Line: bind.Line, Warning: warning,
+			Message: bind.combo() + " " + fmt.Sprintf(format, args...)})
+	}
+
+	key := c.submap + "\x00" + comboKey(bind)
+	if first, ok := c.bound[key]; ok {
+		issue(false, "is already bound at %s:%d (%s), both run", first.File, first.Line, first.description())
+	} else {
+		c.bound[key] = bind
+	}
+
+	if bind.Dispatcher != "exec" && bind.Dispatcher != "execr" {
+		return
+	}
+	for _, script := range scriptPaths(bind.Arg) {
+		if _, err := c.read(script); os.IsNotExist(err) {
+			issue(false, "runs %s, which doesn't exist", displayPath(script))
+		}
+	}
+	for _, command := range execCommands(bind.Arg) {
+		if pkg, steps, missing := missingPackage(command, c.planned); missing {
+			issue(true, "runs %s, but %s is neither installed nor selected (%s)", command, pkg, strings.Join(steps, ", "))
+		}
+	}
+}
+
+// missingPackage returns the package of a command that is neither on $PATH
+// nor planned, and the steps installing it. Commands no step installs are
+// never missing.
+func missingPackage(command string, planned map[string]bool) (pkg string, steps []string, missing bool) {
+	pkg = command
+	if name, ok := commandPackages[command]; ok {
+		pkg = name
+	}
+	steps = packageSteps(pkg)
+	if len(steps) == 0 || planned[pkg] {
+		return pkg, steps, false
+	}
+	_, err := exec.LookPath(command)
+	return pkg, steps, err != nil
+}
@@ -22,7 +22,7 @@ go mod tidy
 
 # Build the application
 echo "Building application..."
-go build -o dotfiles-installer main.go
+go build -o dotfiles-installer .
 
 if [ $? -eq 0 ]; then
     # Make the installer executable
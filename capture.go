@@ -0,0 +1,554 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// volatileFiles are never offered for capture: caches, backups and editor
+// leftovers. Patterns without a slash match the file name, patterns ending
+// in a slash match a directory anywhere.
+var volatileFiles = []string{
+	"*~",
+	"*.bak",
+	"*.log",
+	"*.swp",
+	"*.tmp",
+	"*" + keepBothSuffix,
+	".dotfiles-installer-*",
+	"__pycache__/",
+}
+
+func isVolatile(rel string) bool {
+	for _, pattern := range volatileFiles {
+		switch {
+		case strings.HasSuffix(pattern, "/"):
+			if strings.HasPrefix(rel, pattern) || strings.Contains(rel, "/"+pattern) {
+				return true
+			}
+		case !strings.Contains(pattern, "/"):
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+		default:
+			if ok, _ := path.Match(pattern, rel); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// captureFile is a file in $HOME that can be copied back into the checkout,
+// as a whole or hunk by hunk.
+type captureFile struct {
+	Path   string
+	Status driftStatus
+	Source string
+	Target string
+
+	// ops and hunks are the changes from the checkout to $HOME. They are
+	// nil for extra and binary files, which are captured as a whole.
+	ops   []diffOp
+	hunks []diffHunk
+	// selected has an entry per hunk, or a single one for whole files
+	selected []bool
+	// secrets lists, by entry of selected, the lines that look like
+	// credentials. Such entries can't be selected.
+	secrets [][]secretFinding
+}
+
+// newCaptureFile diffs a drifted file. It returns false for files there is
+// nothing to capture from, such as missing ones.
+func newCaptureFile(report driftReport, drift driftEntry) (captureFile, bool, error) {
+	file := captureFile{
+		Path:     drift.Path,
+		Status:   drift.Status,
+		Source:   filepath.Join(report.Source, drift.Path),
+		Target:   filepath.Join(report.Home, drift.Path),
+		selected: []bool{false},
+	}
+	if drift.Status == driftExtra {
+		have, err := os.ReadFile(file.Target)
+		if err != nil {
+			return file, false, err
+		}
+		file.secrets = [][]secretFinding{scanSecrets(have)}
+		return file, true, nil
+	}
+	// Templates and merged files have to be edited in the checkout by hand
+	if _, ok := report.rendered[drift.Path]; ok || drift.Status != driftModified || drift.HomeSHA256 == "" {
+		return file, false, nil
+	}
+
+	want, err := os.ReadFile(file.Source)
+	if err != nil {
+		return file, false, err
+	}
+	have, err := os.ReadFile(file.Target)
+	if err != nil {
+		return file, false, err
+	}
+	file.secrets = [][]secretFinding{scanSecrets(have)}
+	if isBinary(want) || isBinary(have) {
+		return file, true, nil
+	}
+	// Files differing only in the final newline have no hunks
+	ops := diffLines(splitLines(want), splitLines(have))
+	if hunks := diffHunks(ops); hunks != nil {
+		file.ops, file.hunks = ops, hunks
+		file.selected = make([]bool, len(hunks))
+		file.secrets = make([][]secretFinding, len(hunks))
+		for i, hunk := range hunks {
+			file.secrets[i] = hunkSecrets(ops, hunk)
+		}
+	}
+	return file, true, nil
+}
+
+// hunkSecrets scans the lines a hunk adds, numbering them as in $HOME.
+func hunkSecrets(ops []diffOp, hunk diffHunk) []secretFinding {
+	var findings []secretFinding
+	line := hunk.BStart
+	for _, op := range ops[hunk.Start:hunk.End] {
+		if op.Kind == '-' {
+			continue
+		}
+		line++
+		if rule := matchSecret(op.Line); op.Kind == '+' && rule != "" {
+			findings = append(findings, secretFinding{Rule: rule, Line: line})
+		}
+	}
+	return findings
+}
+
+// blocked reports whether an entry of selected adds secrets to the checkout.
+func (f captureFile) blocked(i int) bool {
+	return len(f.secrets[i]) > 0
+}
+
+// selectable counts the entries that can be selected.
+func (f captureFile) selectable() int {
+	n := 0
+	for i := range f.selected {
+		if !f.blocked(i) {
+			n++
+		}
+	}
+	return n
+}
+
+// content returns what the file in the checkout becomes.
+func (f captureFile) content() ([]byte, error) {
+	if f.hunks == nil {
+		return os.ReadFile(f.Target)
+	}
+	lines := applyHunks(f.ops, f.hunks, f.selected)
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// capture writes the selection into the checkout, keeping the mode of the
+// file there or taking the one in $HOME for new files.
+func (f captureFile) capture() error {
+	content, err := f.content()
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(f.Source)
+	if os.IsNotExist(err) {
+		info, err = os.Stat(f.Target)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.Source, content, info.Mode().Perm())
+}
+
+func (f captureFile) count() int {
+	n := 0
+	for _, selected := range f.selected {
+		if selected {
+			n++
+		}
+	}
+	return n
+}
+
+// toggle selects everything but the secrets, or nothing when that is
+// already selected.
+func (f captureFile) toggle() {
+	f.selectAll(f.count() < f.selectable())
+}
+
+func (f captureFile) selectAll(selected bool) {
+	for i := range f.selected {
+		f.selected[i] = selected && !f.blocked(i)
+	}
+}
+
+// captureModel copies changes made in $HOME back into share/dotfiles.
+type captureModel struct {
+	files    []captureFile
+	expanded map[string]bool
+	cursor   int
+	offset   int
+	height   int
+	results  []string
+	done     bool
+
+	// hunks is set while the hunks of the file under the cursor are shown
+	hunks      bool
+	hunkCursor int
+}
+
+func newCaptureModel(report driftReport) (captureModel, error) {
+	m := captureModel{expanded: map[string]bool{"": true}}
+	for _, drift := range report.Files {
+		if isVolatile(drift.Path) {
+			continue
+		}
+		file, ok, err := newCaptureFile(report, drift)
+		if err != nil {
+			return m, err
+		}
+		if !ok {
+			continue
+		}
+		m.files = append(m.files, file)
+		for dir := path.Dir(file.Path); dir != "."; dir = path.Dir(dir) {
+			m.expanded[dir+"/"] = true
+		}
+	}
+	return m, nil
+}
+
+func (m captureModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m captureModel) rows() []reviewRow {
+	paths := make([]string, len(m.files))
+	for i, file := range m.files {
+		paths[i] = file.Path
+	}
+	return treeRows(paths, m.expanded)
+}
+
+// under returns the indexes of the files a row stands for.
+func (m captureModel) under(row reviewRow) []int {
+	if row.File >= 0 {
+		return []int{row.File}
+	}
+	var files []int
+	for i, file := range m.files {
+		if strings.HasPrefix(file.Path, row.Dir) {
+			files = append(files, i)
+		}
+	}
+	return files
+}
+
+func (m captureModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		if m.done {
+			return m, tea.Quit
+		}
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.hunks {
+			return m.updateHunks(msg)
+		}
+
+		rows := m.rows()
+		switch msg.String() {
+		case "q", "esc":
+			return m, tea.Quit
+		case "enter":
+			m.captureSelected()
+			m.done = true
+			return m, nil
+		}
+		if len(rows) == 0 {
+			return m, nil
+		}
+		row := rows[m.cursor]
+
+		page := m.listHeight()
+		switch msg.String() {
+		case "up", "k":
+			m.cursor = max(m.cursor-1, 0)
+		case "down", "j":
+			m.cursor = min(m.cursor+1, len(rows)-1)
+		case "pgup":
+			m.cursor = max(m.cursor-page, 0)
+		case "pgdown":
+			m.cursor = min(m.cursor+page, len(rows)-1)
+		case "right", "l":
+			if row.File < 0 {
+				m.expanded[row.Dir] = true
+			}
+		case "left", "h":
+			if row.File < 0 {
+				m.expanded[row.Dir] = false
+			}
+		case "space", " ":
+			if row.File < 0 {
+				m.expanded[row.Dir] = !m.expanded[row.Dir]
+			} else {
+				m.files[row.File].toggle()
+			}
+		case "a":
+			// Select everything below the row, or nothing when everything is
+			all := true
+			for _, i := range m.under(row) {
+				all = all && m.files[i].count() == m.files[i].selectable()
+			}
+			for _, i := range m.under(row) {
+				m.files[i].selectAll(!all)
+			}
+		case "d":
+			if row.File >= 0 && m.files[row.File].hunks != nil {
+				m.hunks, m.hunkCursor = true, 0
+			}
+		}
+
+		m.cursor = min(m.cursor, len(m.rows())-1)
+		if m.cursor < m.offset {
+			m.offset = m.cursor
+		} else if m.cursor >= m.offset+page {
+			m.offset = m.cursor - page + 1
+		}
+	}
+	return m, nil
+}
+
+func (m captureModel) updateHunks(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	file := m.files[m.rows()[m.cursor].File]
+	switch msg.String() {
+	case "esc", "q", "d":
+		m.hunks = false
+	case "up", "k":
+		m.hunkCursor = max(m.hunkCursor-1, 0)
+	case "down", "j":
+		m.hunkCursor = min(m.hunkCursor+1, len(file.hunks)-1)
+	case "space", " ":
+		if !file.blocked(m.hunkCursor) {
+			file.selected[m.hunkCursor] = !file.selected[m.hunkCursor]
+		}
+	case "a":
+		file.toggle()
+	}
+	return m, nil
+}
+
+// captureSelected writes the selected files and hunks into the checkout.
+func (m *captureModel) captureSelected() {
+	for _, file := range m.files {
+		n := file.count()
+		if n == 0 {
+			continue
+		}
+		if err := file.capture(); err != nil {
+			m.results = append(m.results, errorStyle.Render(fmt.Sprintf("❌ %s: %v", file.Path, err)))
+		} else if file.hunks != nil && n < len(file.hunks) {
+			m.results = append(m.results, successStyle.Render(fmt.Sprintf("✅ Captured %d of %d hunks of %s", n, len(file.hunks), file.Path)))
+		} else {
+			m.results = append(m.results, successStyle.Render("✅ Captured "+file.Path))
+		}
+	}
+}
+
+func (m captureModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-10, 5)
+}
+
+func (m captureModel) View() string {
+	var result strings.Builder
+
+	if m.done {
+		result.WriteString(titleStyle.Render("📥 Capture"))
+		result.WriteString("\n")
+		if len(m.results) == 0 {
+			result.WriteString("Nothing was selected.\n")
+		}
+		for _, line := range m.results {
+			result.WriteString(line)
+			result.WriteString("\n")
+		}
+		if len(m.results) > 0 {
+			result.WriteString("\nReview the changes with `git diff` before committing them.\n")
+		}
+		result.WriteString("\nPress any key to exit...")
+		return result.String()
+	}
+
+	if m.hunks {
+		return m.hunksView()
+	}
+
+	result.WriteString(titleStyle.Render("📥 Capture Local Changes"))
+	result.WriteString("\n")
+
+	rows := m.rows()
+	if len(rows) == 0 {
+		result.WriteString(successStyle.Render("✅ Nothing to capture, your configuration matches share/dotfiles."))
+		result.WriteString("\n\nPress 'q' to quit")
+		return result.String()
+	}
+
+	end := min(m.offset+m.listHeight(), len(rows))
+	for i := m.offset; i < end; i++ {
+		line := strings.Repeat("  ", rows[i].Depth) + m.rowLabel(rows[i])
+		if i == m.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else {
+			result.WriteString(m.rowStyle(rows[i]).Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	result.WriteString("\nUse ↑↓ to navigate, →← to expand or fold, SPACE to select a file, 'a' to select everything below\n")
+	result.WriteString("d to pick hunks, ENTER to copy the selection into share/dotfiles, 'q' to quit")
+	return result.String()
+}
+
+func (m captureModel) hunksView() string {
+	var result strings.Builder
+	file := m.files[m.rows()[m.cursor].File]
+	result.WriteString(titleStyle.Render("📥 Hunks of " + file.Path))
+	result.WriteString("\n")
+
+	// Start at the hunk under the cursor
+	var lines []string
+	for i, hunk := range file.hunks[m.hunkCursor:] {
+		checkbox := "[ ]"
+		if file.selected[m.hunkCursor+i] {
+			checkbox = "[✓]"
+		}
+		header := checkbox + " " + hunk.header()
+		if secrets := file.secrets[m.hunkCursor+i]; len(secrets) > 0 {
+			header = "[✗] " + hunk.header() + fmt.Sprintf("  blocked: %s", secrets[0])
+		}
+		if i == 0 {
+			lines = append(lines, selectedStyle.Render("▶ "+header))
+		} else {
+			lines = append(lines, diffHunkStyle.Render("  "+header))
+		}
+		for _, op := range file.ops[hunk.Start:hunk.End] {
+			lines = append(lines, renderDiffLine(string(op.Kind)+op.Line))
+		}
+	}
+	for _, line := range lines[:min(m.listHeight(), len(lines))] {
+		result.WriteString(line)
+		result.WriteString("\n")
+	}
+
+	result.WriteString(fmt.Sprintf("\nHunk %d of %d, %d selected. Lines with + are in your copy, lines with - only in share/dotfiles.\n",
+		m.hunkCursor+1, len(file.hunks), file.count()))
+	result.WriteString("Use ↑↓ to move between hunks, SPACE to select one, 'a' to toggle all, ESC to go back")
+	return result.String()
+}
+
+func (m captureModel) rowLabel(row reviewRow) string {
+	if row.File >= 0 {
+		file := m.files[row.File]
+		checkbox := "[ ]"
+		if n := file.count(); file.selectable() == 0 {
+			checkbox = "[✗]"
+		} else if n == file.selectable() {
+			checkbox = "[✓]"
+		} else if n > 0 {
+			checkbox = "[~]"
+		}
+		label := fmt.Sprintf("%s %s  %s", checkbox, path.Base(file.Path), file.Status)
+		if file.hunks != nil {
+			label += fmt.Sprintf(", %d of %d hunks", file.count(), len(file.hunks))
+		}
+		for _, secrets := range file.secrets {
+			if len(secrets) > 0 {
+				label += fmt.Sprintf(" (blocked: %s)", secrets[0])
+				break
+			}
+		}
+		return label
+	}
+
+	marker := "▸"
+	if m.expanded[row.Dir] {
+		marker = "▾"
+	}
+	selected := 0
+	files := m.under(row)
+	for _, i := range files {
+		if m.files[i].count() > 0 {
+			selected++
+		}
+	}
+	return fmt.Sprintf("%s %s  %d of %d selected", marker, path.Base(row.Dir)+"/", selected, len(files))
+}
+
+func (m captureModel) rowStyle(row reviewRow) lipgloss.Style {
+	if row.File < 0 {
+		return categoryStyle.UnsetMarginTop().UnsetMarginLeft()
+	}
+	file := m.files[row.File]
+	switch {
+	case file.count() > 0:
+		return successStyle
+	case file.selectable() == 0:
+		return errorStyle
+	}
+	return unselectedStyle
+}
+
+// captureCommand implements `dotfiles-installer capture`.
+func captureCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: dotfiles-installer capture")
+	}
+
+	source, err := filepath.Abs(dotfilesSourceDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	prof, err := loadProfile()
+	if err != nil {
+		return err
+	}
+	report, err := checkDrift(source, home, prof)
+	if err != nil {
+		return err
+	}
+	m, err := newCaptureModel(report)
+	if err != nil {
+		return err
+	}
+
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around a change.
+const diffContext = 3
+
+// diffOp is a line of an edit script: kept (' '), removed ('-') or added ('+').
+type diffOp struct {
+	Kind byte
+	Line string
+}
+
+// splitLines splits file content into lines without their newlines.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// isBinary reports whether data looks like a binary file.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// diffLines computes a shortest edit script turning a into b using Myers'
+// O(ND) algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// Keep V of every round to walk the path back afterwards
+	var trace [][]int
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{Kind: ' ', Line: a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{Kind: '+', Line: b[prevY]})
+			} else {
+				ops = append(ops, diffOp{Kind: '-', Line: a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// diffHunk is a group of nearby changes with the unchanged lines around
+// them. Start and End index the edit script, the other fields are 0-based
+// line numbers and counts in a and b.
+type diffHunk struct {
+	Start, End     int
+	AStart, ACount int
+	BStart, BCount int
+}
+
+// diffHunks groups an edit script into hunks.
+func diffHunks(ops []diffOp) []diffHunk {
+	// Line numbers in a and b at the start of every op
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.Kind != '+' {
+			aLine[i+1]++
+		}
+		if op.Kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	var hunks []diffHunk
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			i++
+			continue
+		}
+
+		// Merge changes separated by less than two contexts into one hunk
+		start := max(i-diffContext, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				end = min(end+diffContext, len(ops))
+				break
+			}
+			end = run
+		}
+
+		hunks = append(hunks, diffHunk{
+			Start: start, End: end,
+			AStart: aLine[start], ACount: aLine[end] - aLine[start],
+			BStart: bLine[start], BCount: bLine[end] - bLine[start],
+		})
+		i = end
+	}
+	return hunks
+}
+
+func (h diffHunk) header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.AStart, h.ACount), hunkRange(h.BStart, h.BCount))
+}
+
+// unifiedDiff renders the changes from a to b in unified diff format. It
+// returns an empty string when both are equal.
+func unifiedDiff(fromName, toName string, a, b []string) string {
+	ops := diffLines(a, b)
+	hunks := diffHunks(ops)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for _, hunk := range hunks {
+		out.WriteString(hunk.header())
+		out.WriteByte('\n')
+		for _, op := range ops[hunk.Start:hunk.End] {
+			out.WriteByte(op.Kind)
+			out.WriteString(op.Line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.String()
+}
+
+// applyHunks returns a with the selected hunks of the edit script from a to
+// b applied.
+func applyHunks(ops []diffOp, hunks []diffHunk, selected []bool) []string {
+	var lines []string
+	h := 0
+	for i, op := range ops {
+		for h < len(hunks) && i >= hunks[h].End {
+			h++
+		}
+		apply := h < len(hunks) && i >= hunks[h].Start && selected[h]
+		if op.Kind == ' ' || (op.Kind == '-') != apply {
+			lines = append(lines, op.Line)
+		}
+	}
+	return lines
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	dotfilesStep      = "copy_dotfiles"
+	dotfilesSourceDir = "share/dotfiles"
+
+	// keepBothSuffix is appended to the incoming file when the user keeps
+	// both versions; the existing file stays in place.
+	keepBothSuffix = ".dotfiles-new"
+)
+
+// deployMode is how the dotfiles end up in $HOME.
+type deployMode string
+
+const (
+	deployCopy deployMode = "copy"
+	// deployLink symlinks the files into $HOME like GNU stow, so that edits
+	// land in the dotfiles checkout
+	deployLink deployMode = "symlink"
+)
+
+type dotfileState string
+
+const (
+	dotfileNew       dotfileState = "new"
+	dotfileIdentical dotfileState = "identical"
+	dotfileChanged   dotfileState = "would overwrite"
+	// In symlink mode
+	dotfileLinked   dotfileState = "linked"
+	dotfileConflict dotfileState = "conflict"
+)
+
+type dotfileAction string
+
+const (
+	dotfileAccept   dotfileAction = "accept"
+	dotfileSkip     dotfileAction = "skip"
+	dotfileKeepBoth dotfileAction = "keep both"
+	// dotfileAdopt moves the existing file into the checkout before linking
+	dotfileAdopt dotfileAction = "adopt"
+)
+
+// dotfile is a file shipped in share/dotfiles and where it goes in $HOME.
+type dotfile struct {
+	// Path is relative to both the source directory and $HOME
+	Path   string
+	Source string
+	Target string
+	Mode   fs.FileMode
+	State  dotfileState
+	Action dotfileAction
+	// Rendered is what is written instead of the source file, for templates
+	// and merged files. Such files are always copied, never linked.
+	Rendered []byte
+	Strategy mergeStrategy
+	// Note explains a merge that fell back to overwriting
+	Note string
+	// Encrypted is set for files decrypted from *.age or *.gpg
+	Encrypted bool
+	// Secrets are what look like credentials in a plain file
+	Secrets []secretFinding
+}
+
+// dotfilesTree is the checkout with what decides how its files are
+// deployed: the profile for templates, .dotfilesignore, the manifest and
+// the passphrase of the encrypted files.
+type dotfilesTree struct {
+	source     string
+	profile    profile
+	ignore     *dotfilesIgnore
+	manifest   dotfilesManifest
+	passphrase string
+}
+
+// errLocked is returned for an encrypted file when there is no passphrase.
+var errLocked = errors.New("encrypted, needs the passphrase")
+
+func loadDotfilesTree(source string, p profile) (*dotfilesTree, error) {
+	if err := p.validate(source); err != nil {
+		return nil, err
+	}
+	ignore, err := loadDotfilesIgnore(source)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := loadDotfilesManifest(source)
+	if err != nil {
+		return nil, err
+	}
+	return &dotfilesTree{source: source, profile: p, ignore: ignore, manifest: manifest}, nil
+}
+
+func (t *dotfilesTree) walk(fn func(rel string, entry fs.DirEntry) error) error {
+	return walkDotfiles(t.source, t.ignore, fn)
+}
+
+// dotfile describes the file at rel, decrypting it if it is encrypted,
+// rendering it with the profile if it is a template and merging it with the
+// file in home if the manifest says so. Without a passphrase, encrypted
+// files return errLocked.
+func (t *dotfilesTree) dotfile(home, rel string, mode fs.FileMode) (dotfile, error) {
+	file := dotfile{
+		Path:   filepath.ToSlash(rel),
+		Source: filepath.Join(t.source, rel),
+		Target: filepath.Join(home, rel),
+		Mode:   mode,
+		Action: dotfileAccept,
+	}
+	if isEncrypted(rel) {
+		file.Path = strings.TrimSuffix(strings.TrimSuffix(file.Path, ageSuffix), gpgSuffix)
+		file.Target = filepath.Join(home, file.Path)
+		file.Encrypted = true
+		if t.passphrase == "" {
+			return file, errLocked
+		}
+		plain, err := decryptFile(file.Source, t.passphrase)
+		if err != nil {
+			return file, fmt.Errorf("decrypting %s: %w", rel, err)
+		}
+		// Whatever was worth encrypting is not for other users to read
+		file.Rendered, file.Mode = plain, 0600
+	} else if strings.HasSuffix(rel, templateSuffix) {
+		file.Path = strings.TrimSuffix(file.Path, templateSuffix)
+		file.Target = strings.TrimSuffix(file.Target, templateSuffix)
+		rendered, err := renderTemplate(t.source, file.Source, t.profile)
+		if err != nil {
+			return file, fmt.Errorf("rendering %s: %w", rel, err)
+		}
+		file.Rendered = rendered
+	}
+	if err := t.profile.applySetting(&file); err != nil {
+		return file, err
+	}
+	if err := t.profile.applyWaybar(&file); err != nil {
+		return file, err
+	}
+	if err := t.profile.applyAutostart(&file); err != nil {
+		return file, err
+	}
+	if content, ok := t.profile.generated()[file.Path]; ok {
+		file.Rendered = content
+	}
+
+	if strategy := t.manifest.strategy(file.Path); strategy != mergeOverwrite {
+		file.Strategy = strategy
+		want, err := file.content()
+		if err != nil {
+			return file, err
+		}
+		file.Rendered = want
+		if info, err := os.Stat(file.Target); err == nil && info.Mode().IsRegular() {
+			have, err := os.ReadFile(file.Target)
+			if err != nil {
+				return file, err
+			}
+			if merged, err := mergeContent(strategy, have, want); err != nil {
+				file.Note = fmt.Sprintf("%s merge failed, would overwrite: %v", strategy, err)
+			} else {
+				file.Rendered = merged
+			}
+		}
+	}
+
+	// Encrypted files are expected to hold secrets
+	if !file.Encrypted {
+		content, err := file.content()
+		if err != nil {
+			return file, err
+		}
+		file.Secrets = scanSecrets(content)
+	}
+	return file, nil
+}
+
+// content returns what the file looks like in $HOME.
+func (f dotfile) content() ([]byte, error) {
+	if f.Rendered != nil {
+		return f.Rendered, nil
+	}
+	return os.ReadFile(f.Source)
+}
+
+// compareState sets the state of a file from its counterpart in home, and
+// the action it defaults to.
+func compareState(file *dotfile, mode deployMode) error {
+	content, err := compareDotfile(*file)
+	if err != nil {
+		return err
+	}
+	file.State = content
+	if mode == deployLink && file.Rendered == nil {
+		file.State = compareLink(*file, content)
+	}
+	switch file.State {
+	case dotfileIdentical, dotfileLinked:
+		file.Action = dotfileSkip
+	case dotfileConflict:
+		// Replacing an identical copy by a link loses nothing
+		if content != dotfileIdentical {
+			file.Action = dotfileSkip
+		}
+	}
+	return nil
+}
+
+// scanDotfiles compares every file below source with its counterpart below
+// home. Changed files default to being overwritten, as before, but nothing
+// is written until the user has reviewed them. In symlink mode, files in
+// the way default to being left alone unless they are identical. Templates
+// are rendered with the profile and are copied even in symlink mode. Files
+// listed in .dotfilesignore are left out, and so are the encrypted files
+// when the tree has no passphrase: their paths are returned as locked.
+func scanDotfiles(tree *dotfilesTree, home string, mode deployMode) (files []dotfile, locked []string, err error) {
+	err = tree.walk(func(rel string, entry fs.DirEntry) error {
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		file, err := tree.dotfile(home, rel, info.Mode().Perm())
+		if errors.Is(err, errLocked) {
+			locked = append(locked, file.Path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := compareState(&file, mode); err != nil {
+			return err
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("scanning %s: %w", tree.source, err)
+	}
+
+	// The files the profile adds, unless the checkout has them too
+	for rel, content := range tree.profile.generated() {
+		if slices.ContainsFunc(files, func(file dotfile) bool { return file.Path == rel }) {
+			continue
+		}
+		file := dotfile{
+			Path:     rel,
+			Source:   filepath.Join(tree.source, rel),
+			Target:   filepath.Join(home, rel),
+			Mode:     0644,
+			Action:   dotfileAccept,
+			Rendered: content,
+		}
+		if err := compareState(&file, mode); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, locked, nil
+}
+
+func compareDotfile(file dotfile) (dotfileState, error) {
+	info, err := os.Stat(file.Target)
+	if os.IsNotExist(err) {
+		return dotfileNew, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return dotfileChanged, nil
+	}
+
+	want, err := file.content()
+	if err != nil {
+		return "", err
+	}
+	have, err := os.ReadFile(file.Target)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Equal(want, have) {
+		return dotfileIdentical, nil
+	}
+	return dotfileChanged, nil
+}
+
+// compareLink tells whether the target already resolves to the file in the
+// checkout, through its own symlink or a linked parent directory.
+func compareLink(file dotfile, content dotfileState) dotfileState {
+	if content == dotfileNew {
+		return dotfileNew
+	}
+	want, err := filepath.EvalSymlinks(file.Source)
+	if err != nil {
+		return dotfileConflict
+	}
+	if have, err := filepath.EvalSymlinks(file.Target); err == nil && have == want {
+		return dotfileLinked
+	}
+	return dotfileConflict
+}
+
+// diff renders the change writing the file would make to $HOME.
+func (f dotfile) diff() ([]string, error) {
+	want, err := f.content()
+	if err != nil {
+		return nil, err
+	}
+
+	var have []byte
+	fromName := "/dev/null"
+	if f.State != dotfileNew {
+		info, err := os.Stat(f.Target)
+		if err != nil {
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			return []string{fmt.Sprintf("%s is not a regular file and would be replaced", f.Target)}, nil
+		}
+		if have, err = os.ReadFile(f.Target); err != nil {
+			return nil, err
+		}
+		fromName = f.Target
+	}
+
+	if isBinary(want) || isBinary(have) {
+		return []string{fmt.Sprintf("Binary files %s and %s differ", fromName, f.Source)}, nil
+	}
+	return splitLines([]byte(unifiedDiff(fromName, f.Source, splitLines(have), splitLines(want)))), nil
+}
+
+// deployDotfiles writes the accepted files into $HOME, backing up every file
+// it replaces first. It returns the failures in the form the step runner
+// reports them.
+func deployDotfiles(files []dotfile, backup *dotfileBackup, output func(string)) []string {
+	var failures []string
+	written, replaced, skipped := 0, 0, 0
+	for _, file := range files {
+		if file.State == dotfileIdentical || file.Action == dotfileSkip {
+			skipped++
+			continue
+		}
+
+		target := file.Target
+		if file.Action == dotfileKeepBoth && file.State == dotfileChanged {
+			target += keepBothSuffix
+		}
+		entry, err := writeDotfile(file, target, backup, output)
+		if err != nil {
+			failures = append(failures, "Dotfile "+file.Path)
+			continue
+		}
+		if entry.Reason == reasonReplaced {
+			replaced++
+		}
+		written++
+	}
+
+	output(fmt.Sprintf("📋 Wrote %d file(s), left %d unchanged", written, skipped))
+	if replaced > 0 {
+		output(fmt.Sprintf("💾 Backed up %d replaced file(s) to %s", replaced, backup.dir))
+	}
+	return failures
+}
+
+// writeDotfile backs up what is at target, writes the file there and
+// records it in the manifest.
+func writeDotfile(file dotfile, target string, backup *dotfileBackup, output func(string)) (backupEntry, error) {
+	entry, err := backup.preserve(target)
+	if err != nil {
+		output(fmt.Sprintf("❌ Error: Failed to back up %s, leaving it alone: %v", target, err))
+		return entry, err
+	}
+	if entry.Installed, err = installDotfile(file, target); err != nil {
+		output(fmt.Sprintf("❌ Error: Failed to write %s: %v", target, err))
+		return entry, err
+	}
+	if err := backup.add(entry); err != nil {
+		output(fmt.Sprintf("⚠️  Warning: %v", err))
+	}
+	return entry, nil
+}
+
+// installDotfile writes the file to target and returns the hash of what it
+// wrote.
+func installDotfile(file dotfile, target string) (string, error) {
+	content, err := file.content()
+	if err != nil {
+		return "", err
+	}
+
+	return sha256Hex(content), writeFileAtomic(target, content, file.deployedMode())
+}
+
+// deployedMode is the permissions the file gets in $HOME.
+func (f dotfile) deployedMode() fs.FileMode {
+	// Scripts called from the configs have to be executable
+	if strings.HasSuffix(f.Path, ".sh") {
+		return f.Mode | 0111
+	}
+	return f.Mode
+}
+
+// writeFileAtomic writes content to target through a temporary file, so an
+// interrupted copy never leaves a truncated config behind.
+func writeFileAtomic(target string, content []byte, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".dotfiles-installer-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(target); err == nil && info.IsDir() {
+		return fmt.Errorf("a directory is in the way")
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// dotfilesRuntimeDirs are the directories the dotfiles' scripts write to
+// but that ship empty, so .dotfilesignore leaves them out.
+var dotfilesRuntimeDirs = []string{".config/ml4w/cache"}
+
+// runDotfilesStep is the Go implementation of the Dotfiles step.
+func (m model) runDotfilesStep(run *runState, output func(string)) unitResult {
+	output("📂 Copying dotfiles configuration...")
+	if len(m.review.files) == 0 {
+		output(fmt.Sprintf("❌ Error: no dotfiles found in %s", dotfilesSourceDir))
+		return unitResult{Function: dotfilesStep, ExitCode: 1, Failures: []string{"Dotfiles source directory not found"}}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		output(fmt.Sprintf("❌ Error: %v", err))
+		return unitResult{Function: dotfilesStep, ExitCode: 1}
+	}
+
+	for _, file := range m.review.files {
+		if len(file.Secrets) > 0 && file.Action != dotfileSkip && file.State != dotfileIdentical {
+			output(fmt.Sprintf("⚠️  Warning: %s looks like it contains a %s", file.Path, file.Secrets[0]))
+		}
+	}
+	for _, issue := range m.review.hypr {
+		if !issue.Warning {
+			output(fmt.Sprintf("⚠️  Warning: Hyprland config: %s", issue))
+		}
+	}
+
+	result := unitResult{Function: dotfilesStep}
+	backup := newDotfileBackup(run, home)
+	if m.review.mode == deployLink {
+		result.Failures = linkDotfiles(m.review.files, m.review.source, home, backup, output)
+	} else {
+		result.Failures = deployDotfiles(m.review.files, backup, output)
+	}
+	for _, dir := range dotfilesRuntimeDirs {
+		if err := os.MkdirAll(filepath.Join(home, dir), 0755); err != nil {
+			output(fmt.Sprintf("⚠️  Warning: Failed to create ~/%s: %v", dir, err))
+		}
+	}
+	if len(result.Failures) > 0 {
+		result.ExitCode = 1
+	} else {
+		output("✅ Dotfiles setup completed")
+	}
+	return result
+}
+
+// dotfilesConfigOverrides links .config directories to the steps installing
+// their application when the directory is not named after a package.
+var dotfilesConfigOverrides = map[string][]string{
+	"fastfetch":              {"setup_fastfetch"},
+	"gtk-3.0":                {"install_theming"},
+	"gtk-4.0":                {"install_theming"},
+	"hypr":                   {"install_hyprland_wm"},
+	"ml4w":                   {"install_hyprland_wm"},
+	"ml4w-hyprland-settings": {"install_hyprland_wm"},
+	"wal":                    {"install_theming"},
+	"waypaper":               {"setup_wallpapers"},
+	"wlogout":                {"install_hyprland_wm"},
+	"zshrc":                  {"setup_zsh"},
+}
+
+// dotfilesConfigSteps turns every directory of share/dotfiles/.config into
+// a selectable sub-item of the Dotfiles step, linked to the steps of
+// categories that install the application it configures.
+func dotfilesConfigSteps(source string, categories []Category) []InstallStep {
+	entries, err := os.ReadDir(filepath.Join(source, ".config"))
+	if err != nil {
+		return nil
+	}
+
+	names := make(map[string]string)
+	for _, category := range categories {
+		for _, step := range category.Steps {
+			names[step.Function] = step.Name
+		}
+	}
+
+	var steps []InstallStep
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		step := InstallStep{
+			Name:     ".config/" + name,
+			Function: dotfilesStep + ":" + name,
+			Config:   ".config/" + name + "/",
+			Apps:     configApps(name),
+			Selected: true,
+		}
+
+		var apps []string
+		for _, function := range step.Apps {
+			apps = append(apps, names[function])
+		}
+		if len(apps) > 0 {
+			step.Description = fmt.Sprintf("%s configuration, follows %s", name, strings.Join(apps, ", "))
+		} else {
+			step.Description = fmt.Sprintf("%s configuration", name)
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// configApps finds the steps installing a package named like the
+// directory, ignoring the -bin and -wayland suffixes of packaged variants.
+func configApps(name string) []string {
+	if apps, ok := dotfilesConfigOverrides[name]; ok {
+		return apps
+	}
+
+	var apps []string
+	for function, packages := range stepPackages {
+		for _, pkg := range append(packages.Repo, packages.AUR...) {
+			if strings.TrimSuffix(strings.TrimSuffix(pkg, "-bin"), "-wayland") == name {
+				apps = append(apps, function)
+				break
+			}
+		}
+	}
+	sort.Strings(apps)
+	return apps
+}
+
+// excludedConfigs returns the .config directories of the deselected
+// dotfiles sub-items.
+func (m model) excludedConfigs() []string {
+	var excluded []string
+	for _, category := range m.categories {
+		for _, step := range category.Steps {
+			if step.Config != "" && !m.selectedSteps[step.Function] {
+				excluded = append(excluded, step.Config)
+			}
+		}
+	}
+	return excluded
+}
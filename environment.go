@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// vmVendors are the DMI vendors and products of virtual machines.
+var vmVendors = []string{"QEMU", "KVM", "VirtualBox", "VMware", "Xen", "Bochs", "Parallels"}
+
+// detectVM returns the hypervisor the system runs under, or "" on bare
+// metal. It asks systemd-detect-virt and falls back to the DMI tables.
+func detectVM() string {
+	out, err := exec.Command("systemd-detect-virt", "--vm").Output()
+	name := strings.TrimSpace(string(out))
+	if name == "none" {
+		return ""
+	}
+	if err == nil && name != "" {
+		return name
+	}
+	for _, file := range []string{"/sys/class/dmi/id/sys_vendor", "/sys/class/dmi/id/product_name"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, vendor := range vmVendors {
+			if strings.Contains(string(data), vendor) {
+				return vendor
+			}
+		}
+	}
+	return ""
+}
+
+// environmentProposal is the variant of hypr/conf/environments the plan
+// selects, and why.
+type environmentProposal struct {
+	Variant string
+	Reason  string
+	// Current is the variant of the profile
+	Current string
+	// Keep is set when the user keeps the current variant instead
+	Keep bool
+}
+
+// proposeEnvironment picks the environment variant for the planned steps
+// and the machine: the KVM one in a virtual machine, where Hyprland needs
+// software rendering, the NVIDIA one with the NVIDIA drivers, and the
+// default one otherwise. It returns no proposal when the checkout doesn't
+// ship the variant.
+func proposeEnvironment(source string, steps []InstallStep, vm string, prof profile) environmentProposal {
+	names := make(map[string]string)
+	for _, step := range steps {
+		names[step.Function] = step.Name
+	}
+
+	var p environmentProposal
+	switch {
+	case vm != "":
+		p = environmentProposal{Variant: "kvm", Reason: fmt.Sprintf("this is a %s virtual machine, where Hyprland needs software rendering", vm)}
+	case names["configure_nvidia"] != "":
+		p = environmentProposal{Variant: "nvidia", Reason: names["configure_nvidia"] + " is selected, and the proprietary driver needs the NVIDIA variables"}
+	case names["install_virtualbox_guest"] != "":
+		p = environmentProposal{Variant: "kvm", Reason: names["install_virtualbox_guest"] + " is selected, so this is a virtual machine"}
+	case names["install_qemu_kvm"] != "":
+		p = environmentProposal{Variant: "kvm", Reason: names["install_qemu_kvm"] + " is selected"}
+	default:
+		p = environmentProposal{Variant: "default", Reason: "no NVIDIA, guest or virtualization step is selected and this isn't a virtual machine"}
+	}
+	if !slices.Contains(presets(source, hyprConfDir+"/environments"), p.Variant) {
+		return environmentProposal{}
+	}
+	p.Current = prof.Variant("environments")
+	return p
+}
+
+// environmentVariant returns the variant the plan switches to, or "" when
+// it leaves the environment as it is.
+func (p installPlan) environmentVariant() string {
+	env := p.Environment
+	if env.Variant == "" || env.Keep || env.Variant == env.Current {
+		return ""
+	}
+	return env.Variant
+}
+
+// applyEnvironment saves the proposed environment variant to the profile
+// once the installation starts. Without the Dotfiles step, which renders it
+// with the rest, environment.conf is written to $HOME right away.
+func (m model) applyEnvironment() error {
+	variant := m.plan.environmentVariant()
+	if variant == "" {
+		return nil
+	}
+	prof, err := loadProfile()
+	if err != nil {
+		return err
+	}
+	prof.setVariant("environments", variant)
+	if err := prof.save(); err != nil {
+		return err
+	}
+	if m.plan.hasStep(dotfilesStep) {
+		return nil
+	}
+
+	source, err := filepath.Abs(dotfilesSourceDir)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	_, err = writeRendered(source, home, prof, hyprConfDir+"/environment.conf")
+	return err
+}
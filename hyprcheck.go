@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// hyprRoot is the file Hyprland loads, relative to $HOME.
+const hyprRoot = ".config/hypr/hyprland.conf"
+
+// hyprIssue is a problem found in the Hyprland config.
+type hyprIssue struct {
+	// File is shown as ~/path, or absolute outside $HOME
+	File    string
+	Line    int
+	Message string
+	// Warning is set for what Hyprland accepts but likely isn't meant
+	Warning bool
+}
+
+func (i hyprIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s", i.File, i.Line, i.Message)
+}
+
+// hyprReader returns the content of a config file by its path relative to
+// $HOME, or its absolute path outside of it.
+type hyprReader func(rel string) ([]byte, error)
+
+// homeReader reads the config deployed in home.
+func homeReader(home string) hyprReader {
+	return func(rel string) ([]byte, error) {
+		if filepath.IsAbs(rel) {
+			return os.ReadFile(rel)
+		}
+		return os.ReadFile(filepath.Join(home, rel))
+	}
+}
+
+// deployedReader reads the config as deploying the dotfiles would leave it:
+// the accepted files as they are written, the others from home.
+func deployedReader(files []dotfile, home string) hyprReader {
+	accepted := make(map[string]dotfile)
+	for _, file := range files {
+		if file.Action == dotfileAccept {
+			accepted[file.Path] = file
+		}
+	}
+	fromHome := homeReader(home)
+	return func(rel string) ([]byte, error) {
+		file, ok := accepted[rel]
+		if !ok {
+			return fromHome(rel)
+		}
+		if file.Rendered != nil {
+			return file.Rendered, nil
+		}
+		return os.ReadFile(file.Source)
+	}
+}
+
+// repeatableHyprKeys may be set any number of times, each line adding
+// something. Binds and variables are too.
+var repeatableHyprKeys = map[string]bool{
+	"source": true, "exec": true, "exec-once": true, "execr": true, "execr-once": true, "exec-shutdown": true,
+	"env": true, "envd": true, "monitor": true, "workspace": true, "windowrule": true, "windowrulev2": true,
+	"layerrule": true, "animation": true, "bezier": true, "gesture": true, "unbind": true, "submap": true,
+	"plugin": true, "permission": true,
+}
+
+func isRepeatableHyprKey(key string) bool {
+	return repeatableHyprKeys[key] || strings.HasPrefix(key, "bind") || strings.HasPrefix(key, "$")
+}
+
+// hyprChecker walks the source graph of the config.
+type hyprChecker struct {
+	read    hyprReader
+	issues  []hyprIssue
+	visited map[string]bool
+	// set is where each setting was last set, by section:key
+	set map[string]string
+	// selectors are the selector files of the variant groups
+	selectors map[string]variantGroup
+
+	vars map[string]string
+	// submap is the submap the binds go to, "" outside of one
+	submap string
+	// bound is the first bind of each key combination, by submap and combo
+	bound map[string]hyprBind
+	// planned are the packages the installation plan installs
+	planned map[string]bool
+}
+
+// checkHyprConfig loads hyprland.conf and the files it sources, in the
+// order Hyprland does, and reports missing sources, empty selector files,
+// settings set twice, lines Hyprland can't parse and binds that clash or
+// run something missing. Commands are missing when they aren't on $PATH and
+// their package isn't planned. It returns nothing when there is no
+// hyprland.conf.
+func checkHyprConfig(read hyprReader, planned []string) []hyprIssue {
+	if _, err := read(hyprRoot); err != nil {
+		return nil
+	}
+	c := hyprChecker{
+		read:      read,
+		visited:   make(map[string]bool),
+		set:       make(map[string]string),
+		selectors: make(map[string]variantGroup),
+		vars:      make(map[string]string),
+		bound:     make(map[string]hyprBind),
+		planned:   make(map[string]bool),
+	}
+	for _, group := range variantGroups {
+		c.selectors[hyprConfDir+"/"+group.Selector] = group
+	}
+	for _, pkg := range planned {
+		c.planned[pkg] = true
+	}
+	data, _ := read(hyprRoot)
+	c.check(hyprRoot, data)
+	return c.issues
+}
+
+func displayPath(rel string) string {
+	if filepath.IsAbs(rel) {
+		return rel
+	}
+	return "~/" + rel
+}
+
+func (c *hyprChecker) check(rel string, data []byte) {
+	c.visited[rel] = true
+	file := displayPath(rel)
+	statements, errs := parseHyprConfig(data)
+	for _, err := range errs {
+		c.issues = append(c.issues, hyprIssue{File: file, Line: err.Line, Message: err.Message})
+	}
+
+	if group, ok := c.selectors[rel]; ok && len(statements) == 0 {
+		c.issues = append(c.issues, hyprIssue{File: file, Line: 1,
+			Message: fmt.Sprintf("is empty, so no %s variant is loaded; run `dotfiles-installer variants`", strings.ToLower(group.Label))})
+	}
+
+	binds := make(map[int]hyprBind)
+	for _, bind := range parseHyprBinds(data) {
+		bind.File = file
+		binds[bind.Line] = bind
+	}
+
+	for _, statement := range statements {
+		at := fmt.Sprintf("%s:%d", file, statement.Line)
+		if statement.Section == "" {
+			switch {
+			case statement.Key == "source":
+				c.source(rel, at, statement)
+				continue
+			case strings.HasPrefix(statement.Key, "$"):
+				c.vars[statement.Key[1:]] = expandHyprVariables(statement.Value, c.vars)
+			case statement.Key == "submap" && statement.Value == "reset":
+				c.submap = ""
+			case statement.Key == "submap":
+				c.submap = statement.Value
+			}
+		}
+		if bind, ok := binds[statement.Line]; ok {
+			c.checkBind(bind.expand(c.vars))
+		}
+		// Every device block configures another device
+		if isRepeatableHyprKey(statement.Key) || strings.HasPrefix(statement.Section, "device") {
+			continue
+		}
+		name := statement.Key
+		if statement.Section != "" {
+			name = statement.Section + ":" + statement.Key
+		}
+		if previous, ok := c.set[name]; ok {
+			c.issues = append(c.issues, hyprIssue{File: file, Line: statement.Line, Warning: true,
+				Message: fmt.Sprintf("%s is set again, overriding %s", name, previous)})
+		}
+		c.set[name] = at
+	}
+}
+
+// source follows a source line, relative to the file it is in unless it
+// starts with ~ or /.
+func (c *hyprChecker) source(rel, at string, statement hyprStatement) {
+	value := statement.Value
+	var target string
+	switch {
+	case value == "~" || strings.HasPrefix(value, "~/"):
+		target = strings.TrimPrefix(strings.TrimPrefix(value, "~"), "/")
+	case filepath.IsAbs(value):
+		target = value
+	default:
+		target = path.Join(path.Dir(rel), value)
+	}
+	// Globs are expanded by Hyprland and may match nothing
+	if strings.ContainsAny(target, "*?[") || c.visited[target] {
+		return
+	}
+
+	data, err := c.read(target)
+	issue := hyprIssue{File: displayPath(rel), Line: statement.Line}
+	switch {
+	case os.IsNotExist(err) && strings.HasPrefix(target, ".cache/"):
+		issue.Message = fmt.Sprintf("sources %s, which doesn't exist yet; it is generated later, e.g. by pywal", displayPath(target))
+		issue.Warning = true
+	case os.IsNotExist(err):
+		issue.Message = fmt.Sprintf("sources %s, which doesn't exist", displayPath(target))
+	case err != nil:
+		issue.Message = fmt.Sprintf("sources %s: %v", displayPath(target), err)
+	default:
+		c.check(target, data)
+		return
+	}
+	c.issues = append(c.issues, issue)
+}
+
+// countHyprIssues returns the number of errors and of warnings.
+func countHyprIssues(issues []hyprIssue) (errors, warnings int) {
+	for _, issue := range issues {
+		if issue.Warning {
+			warnings++
+		} else {
+			errors++
+		}
+	}
+	return errors, warnings
+}
+
+// hyprCheckModel lists the problems found in the Hyprland config.
+type hyprCheckModel struct {
+	// checked is what was checked, for the title
+	checked string
+	issues  []hyprIssue
+	cursor  int
+	offset  int
+	height  int
+}
+
+func (m hyprCheckModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m hyprCheckModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		page := m.listHeight()
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+		case "up", "k":
+			m.cursor = max(m.cursor-1, 0)
+		case "down", "j":
+			m.cursor = max(min(m.cursor+1, len(m.issues)-1), 0)
+		case "pgup":
+			m.cursor = max(m.cursor-page, 0)
+		case "pgdown":
+			m.cursor = max(min(m.cursor+page, len(m.issues)-1), 0)
+		}
+		if m.cursor < m.offset {
+			m.offset = m.cursor
+		} else if m.cursor >= m.offset+page {
+			m.offset = m.cursor - page + 1
+		}
+	}
+	return m, nil
+}
+
+func (m hyprCheckModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-10, 5)
+}
+
+func (m hyprCheckModel) View() string {
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("🔎 Hyprland Config Check"))
+	result.WriteString("\n")
+	result.WriteString(descriptionStyle.Render(m.checked))
+	result.WriteString("\n\n")
+
+	errors, warnings := countHyprIssues(m.issues)
+	if len(m.issues) == 0 {
+		result.WriteString(successStyle.Render("✅ No problems found"))
+		result.WriteString("\n\nPress 'q' to quit")
+		return result.String()
+	}
+	result.WriteString(fmt.Sprintf("%d error(s), %d warning(s)\n\n", errors, warnings))
+
+	end := min(m.offset+m.listHeight(), len(m.issues))
+	for i := m.offset; i < end; i++ {
+		issue := m.issues[i]
+		style := errorStyle
+		line := "✗ " + issue.String()
+		if issue.Warning {
+			style = warningStyle
+			line = "⚠ " + issue.String()
+		}
+		if i == m.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else {
+			result.WriteString(style.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+	result.WriteString("\nUse ↑↓ to navigate, 'q' to quit")
+	return result.String()
+}
+
+// hyprCommand implements `dotfiles-installer hypr`.
+func hyprCommand(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return fmt.Errorf("usage: dotfiles-installer hypr check [--dotfiles]")
+	}
+	return hyprCheckCommand(args[1:])
+}
+
+// hyprCheckCommand checks the Hyprland config in $HOME or, with
+// --dotfiles, the one deploying the checkout would leave there.
+func hyprCheckCommand(args []string) error {
+	dotfiles := false
+	switch {
+	case len(args) == 1 && args[0] == "--dotfiles":
+		dotfiles = true
+	case len(args) > 0:
+		return fmt.Errorf("usage: dotfiles-installer hypr check [--dotfiles]")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	read := homeReader(home)
+	checked := "~/" + hyprRoot + " and the files it sources"
+	if dotfiles {
+		source, err := filepath.Abs(dotfilesSourceDir)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(source); err != nil {
+			return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+		}
+		prof, err := loadProfile()
+		if err != nil {
+			return err
+		}
+		tree, err := loadDotfilesTree(source, prof)
+		if err != nil {
+			return err
+		}
+		// Encrypted files are left as they are in $HOME
+		files, _, err := scanDotfiles(tree, home, deployCopy)
+		if err != nil {
+			return err
+		}
+		read = deployedReader(files, home)
+		checked += ", as deploying the dotfiles would leave them"
+	}
+
+	if _, err := read(hyprRoot); err != nil {
+		return fmt.Errorf("reading the Hyprland config: %w", err)
+	}
+	p := tea.NewProgram(hyprCheckModel{checked: checked, issues: checkHyprConfig(read, nil)}, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
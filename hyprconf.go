@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// hyprBind is a bind line of a Hyprland config, such as
+// `bind = $mainMod, Q, killactive`.
+type hyprBind struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line"`
+	// Group is the heading comment above the bind, such as "# Windows"
+	Group string `json:"group,omitempty"`
+	// Kind is bind or a variant with flags, such as binde or bindm
+	Kind       string `json:"kind"`
+	Mods       string `json:"mods"`
+	Key        string `json:"key"`
+	Dispatcher string `json:"dispatcher"`
+	Arg        string `json:"arg,omitempty"`
+	Comment    string `json:"description,omitempty"`
+}
+
+var (
+	hyprBindLine = regexp.MustCompile(`^\s*(bind[a-z]*)\s*=\s*(.*)$`)
+	// hyprHeading is a comment standing alone after a blank line
+	hyprHeading = regexp.MustCompile(`^#\s*([A-Za-z][A-Za-z0-9 &/()-]*?)\s*$`)
+)
+
+// parseHyprBinds returns the bind lines of a config, leaving variables
+// unexpanded.
+func parseHyprBinds(data []byte) []hyprBind {
+	var binds []hyprBind
+	group := ""
+	lines := splitLines(data)
+	for i, line := range lines {
+		if match := hyprHeading.FindStringSubmatch(strings.TrimSpace(line)); match != nil && (i == 0 || strings.TrimSpace(lines[i-1]) == "") {
+			group = match[1]
+			continue
+		}
+		code, comment := splitHyprComment(line)
+		match := hyprBindLine.FindStringSubmatch(code)
+		if match == nil {
+			continue
+		}
+		fields := strings.SplitN(match[2], ",", 4)
+		for len(fields) < 4 {
+			fields = append(fields, "")
+		}
+		binds = append(binds, hyprBind{
+			Line:       i + 1,
+			Group:      group,
+			Kind:       match[1],
+			Mods:       strings.TrimSpace(fields[0]),
+			Key:        strings.TrimSpace(fields[1]),
+			Dispatcher: strings.TrimSpace(fields[2]),
+			Arg:        strings.TrimSpace(fields[3]),
+			Comment:    comment,
+		})
+	}
+	return binds
+}
+
+// hyprVariables adds the `$name = value` definitions of a config to vars,
+// expanding the variables they use.
+func hyprVariables(data []byte, vars map[string]string) {
+	statements, _ := parseHyprConfig(data)
+	for _, statement := range statements {
+		if name, ok := strings.CutPrefix(statement.Key, "$"); ok && statement.Section == "" {
+			vars[name] = expandHyprVariables(statement.Value, vars)
+		}
+	}
+}
+
+// expandHyprVariables replaces the variables in s, longest name first as
+// Hyprland does, so that $mainModShift isn't read as $mainMod.
+func expandHyprVariables(s string, vars map[string]string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for _, name := range names {
+		s = strings.ReplaceAll(s, "$"+name, vars[name])
+	}
+	return s
+}
+
+// expand returns the bind with its variables replaced.
+func (b hyprBind) expand(vars map[string]string) hyprBind {
+	b.Mods = expandHyprVariables(b.Mods, vars)
+	b.Key = expandHyprVariables(b.Key, vars)
+	b.Arg = expandHyprVariables(b.Arg, vars)
+	return b
+}
+
+// splitHyprComment separates a line from its comment. In Hyprland configs
+// a # starts a comment unless it is doubled.
+func splitHyprComment(line string) (code, comment string) {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '#' {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] == '#' {
+			i++
+			continue
+		}
+		code = strings.ReplaceAll(line[:i], "##", "#")
+		return strings.TrimRight(code, " \t"), strings.TrimSpace(line[i+1:])
+	}
+	return strings.ReplaceAll(line, "##", "#"), ""
+}
+
+// hyprStatement is a `key = value` line of a Hyprland config.
+type hyprStatement struct {
+	Line int
+	// Section is the path of the blocks around it, such as "input:touchpad"
+	Section string
+	Key     string
+	Value   string
+}
+
+// hyprSyntaxError is a line Hyprland can't parse.
+type hyprSyntaxError struct {
+	Line    int
+	Message string
+}
+
+// parseHyprConfig returns the statements of a config and the lines that
+// aren't a statement, a block or a comment.
+func parseHyprConfig(data []byte) ([]hyprStatement, []hyprSyntaxError) {
+	var statements []hyprStatement
+	var errs []hyprSyntaxError
+	type block struct {
+		name string
+		line int
+	}
+	var blocks []block
+	section := func() string {
+		names := make([]string, len(blocks))
+		for i, b := range blocks {
+			names[i] = b.name
+		}
+		return strings.Join(names, ":")
+	}
+
+	for i, line := range splitLines(data) {
+		code, _ := splitHyprComment(line)
+		code = strings.TrimSpace(code)
+		switch {
+		case code == "":
+		case code == "}":
+			if len(blocks) == 0 {
+				errs = append(errs, hyprSyntaxError{i + 1, "} closes no block"})
+				break
+			}
+			blocks = blocks[:len(blocks)-1]
+		case strings.Contains(code, "="):
+			key, value, _ := strings.Cut(code, "=")
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			if key == "" || strings.ContainsAny(key, " \t{}") {
+				errs = append(errs, hyprSyntaxError{i + 1, fmt.Sprintf("%q is not a key", key)})
+				break
+			}
+			if strings.Count(value, `"`)%2 != 0 {
+				errs = append(errs, hyprSyntaxError{i + 1, fmt.Sprintf("unbalanced quote in %s = %s", key, value)})
+			}
+			statements = append(statements, hyprStatement{Line: i + 1, Section: section(), Key: key, Value: value})
+		case strings.HasSuffix(code, "{"):
+			name := strings.TrimSpace(strings.TrimSuffix(code, "{"))
+			if name == "" || strings.ContainsAny(name, " \t") {
+				errs = append(errs, hyprSyntaxError{i + 1, fmt.Sprintf("%q is not a block name", name)})
+			}
+			blocks = append(blocks, block{name, i + 1})
+		default:
+			errs = append(errs, hyprSyntaxError{i + 1, fmt.Sprintf("expected key = value, got %q", code)})
+		}
+	}
+	for _, b := range blocks {
+		errs = append(errs, hyprSyntaxError{b.line, fmt.Sprintf("block %s is never closed", b.name)})
+	}
+	return statements, errs
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// dotfilesIgnoreName is the file at the root of share/dotfiles listing, in
+// gitignore syntax, what is never deployed, compared or captured.
+const dotfilesIgnoreName = ".dotfilesignore"
+
+// dotfilesMetaFiles configure the checkout itself and are never deployed.
+var dotfilesMetaFiles = map[string]bool{
+	dotfilesIgnoreName:   true,
+	dotfilesManifestName: true,
+}
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// dotfilesIgnore holds the patterns of a .dotfilesignore file.
+type dotfilesIgnore struct {
+	patterns []ignorePattern
+}
+
+// loadDotfilesIgnore reads the .dotfilesignore of the checkout. A missing
+// file ignores nothing.
+func loadDotfilesIgnore(source string) (*dotfilesIgnore, error) {
+	ig := &dotfilesIgnore{}
+	file, err := os.Open(filepath.Join(source, dotfilesIgnoreName))
+	if os.IsNotExist(err) {
+		return ig, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		pattern, err := parseIgnorePattern(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", dotfilesIgnoreName, n, err)
+		}
+		if pattern != nil {
+			ig.patterns = append(ig.patterns, *pattern)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dotfilesIgnoreName, err)
+	}
+	return ig, nil
+}
+
+// parseIgnorePattern turns a line of gitignore syntax into a regular
+// expression matching slash-separated paths relative to the root. It
+// returns nil for blank lines and comments.
+func parseIgnorePattern(line string) (*ignorePattern, error) {
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimSuffix(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	pattern := &ignorePattern{}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// A slash anywhere but at the end anchors the pattern to the root,
+	// otherwise it matches a name at any depth
+	var re strings.Builder
+	if strings.Contains(line, "/") {
+		re.WriteString("^")
+		line = strings.TrimPrefix(line, "/")
+	} else {
+		re.WriteString("^(?:.*/)?")
+	}
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case strings.HasPrefix(line[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end < 0 {
+				re.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(line):
+			i++
+			re.WriteString(regexp.QuoteMeta(line[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", line, err)
+	}
+	pattern.re = compiled
+	return pattern, nil
+}
+
+// ignored reports whether a path relative to the root is ignored. As in
+// git, the last matching pattern wins and nothing inside an ignored
+// directory can be re-included.
+func (ig *dotfilesIgnore) ignored(rel string, dir bool) bool {
+	for parent := filepath.ToSlash(filepath.Dir(rel)); parent != "."; parent = filepath.ToSlash(filepath.Dir(parent)) {
+		if ig.match(parent, true) {
+			return true
+		}
+	}
+	return ig.match(rel, dir)
+}
+
+func (ig *dotfilesIgnore) match(rel string, dir bool) bool {
+	ignored := false
+	for _, pattern := range ig.patterns {
+		if pattern.dirOnly && !dir {
+			continue
+		}
+		if pattern.re.MatchString(rel) {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
+
+// walkDotfiles calls fn for every file of the checkout that is deployed,
+// leaving out the meta files and everything .dotfilesignore lists. Paths
+// are relative and slash-separated.
+func walkDotfiles(source string, ig *dotfilesIgnore, fn func(rel string, entry fs.DirEntry) error) error {
+	return filepath.WalkDir(source, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if dotfilesMetaFiles[rel] || ig.ignored(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(rel, entry)
+	})
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// xkbRulesPath lists the keyboard layouts X and Wayland compositors know.
+const xkbRulesPath = "/usr/share/X11/xkb/rules/evdev.lst"
+
+type xkbLayout struct {
+	Name        string
+	Description string
+	Variants    []xkbVariant
+}
+
+type xkbVariant struct {
+	Name        string
+	Description string
+}
+
+// parseXKBRules reads the layout and variant sections of an evdev.lst file.
+func parseXKBRules(r io.Reader) ([]xkbLayout, error) {
+	var layouts []xkbLayout
+	index := make(map[string]int)
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "! "); ok {
+			section = strings.TrimSpace(name)
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[0]
+		description := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), name))
+
+		switch section {
+		case "layout":
+			index[name] = len(layouts)
+			layouts = append(layouts, xkbLayout{Name: name, Description: description})
+		case "variant":
+			// Variants are described as "fr: French (no dead keys)"
+			layout, description, ok := strings.Cut(description, ": ")
+			if i, known := index[layout]; ok && known {
+				layouts[i].Variants = append(layouts[i].Variants, xkbVariant{Name: name, Description: description})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return layouts, nil
+}
+
+// digitRows are the unshifted keys of the number row, for 1 to 9 and 0, on
+// the layouts where they aren't digits, by layout or layout(variant).
+var digitRows = map[string][]string{
+	"fr":       {"ampersand", "eacute", "quotedbl", "apostrophe", "parenleft", "minus", "egrave", "underscore", "ccedilla", "agrave"},
+	"fr(mac)":  {"ampersand", "eacute", "quotedbl", "apostrophe", "parenleft", "section", "egrave", "exclam", "ccedilla", "agrave"},
+	"fr(bepo)": {"quotedbl", "guillemotleft", "guillemotright", "parenleft", "parenright", "at", "plus", "minus", "slash", "asterisk"},
+	"be":       {"ampersand", "eacute", "quotedbl", "apostrophe", "parenleft", "section", "egrave", "exclam", "ccedilla", "agrave"},
+}
+
+var defaultDigitRow = []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "0"}
+
+// digitRow returns the number row of a layout.
+func digitRow(layout, variant string) []string {
+	if row, ok := digitRows[layout+"("+variant+")"]; ok && variant != "" {
+		return row
+	}
+	if row, ok := digitRows[layout]; ok {
+		return row
+	}
+	return defaultDigitRow
+}
+
+// keybindingsFor picks the keybinding preset of a layout: one named after
+// it, the French one for the other AZERTY-style layouts, or the default.
+func keybindingsFor(source, layout, variant string) string {
+	names := presets(source, hyprConfDir+"/keybindings")
+	switch {
+	case slices.Contains(names, layout):
+		return layout
+	case digitRow(layout, variant)[0] == "ampersand" && slices.Contains(names, "fr"):
+		return "fr"
+	default:
+		return "default"
+	}
+}
+
+var moveToWorkspace = regexp.MustCompile(`moveTo\.sh\s+(\d+)$`)
+
+// bindWorkspace returns the workspace number a bind goes to or moves
+// windows to, or 0.
+func bindWorkspace(bind hyprBind) int {
+	arg := bind.Arg
+	switch bind.Dispatcher {
+	case "workspace", "movetoworkspace", "movetoworkspacesilent":
+	case "exec":
+		match := moveToWorkspace.FindStringSubmatch(arg)
+		if match == nil {
+			return 0
+		}
+		arg = match[1]
+	default:
+		return 0
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > 10 {
+		return 0
+	}
+	return n
+}
+
+// checkWorkspaceBinds flags the binds to numbered workspaces whose key isn't
+// on the number row of the layout without Shift, such as 1 on AZERTY, where
+// the key gives an ampersand.
+func checkWorkspaceBinds(binds []hyprBind, layout, variant string) []string {
+	row := digitRow(layout, variant)
+	name := layout
+	if variant != "" {
+		name += "(" + variant + ")"
+	}
+
+	var warnings []string
+	for _, bind := range binds {
+		n := bindWorkspace(bind)
+		// Keycodes don't depend on the layout
+		if n == 0 || strings.HasPrefix(bind.Key, "code:") {
+			continue
+		}
+		want := row[(n-1)%10]
+		if strings.EqualFold(bind.Key, want) {
+			continue
+		}
+		problem := fmt.Sprintf("%s isn't on the number row of %s", bind.Key, name)
+		if slices.Contains(defaultDigitRow, bind.Key) {
+			problem = fmt.Sprintf("%s needs Shift on %s", bind.Key, name)
+		}
+		warnings = append(warnings, fmt.Sprintf("%s:%d: %s, bind %s or code:%d for workspace %d instead",
+			bind.File, bind.Line, problem, want, 10+(n-1)%10, n))
+	}
+	return warnings
+}
+
+// keyboardForm picks the XKB layout and variant, and the keybindings that
+// go with them.
+type keyboardForm struct {
+	source  string
+	home    string
+	profile profile
+	layouts []xkbLayout
+	// deploy writes the rendered files into $HOME. Within the installer the
+	// Dotfiles step writes them instead.
+	deploy bool
+	// filter narrows the layouts down as it is typed
+	filter string
+	cursor int
+	offset int
+	// layout is the layout whose variants are listed, if any
+	layout   *xkbLayout
+	variant  int
+	message  string
+	warnings []string
+	err      error
+}
+
+// loadXKBLayouts reads the layouts from the XKB rules.
+func loadXKBLayouts() ([]xkbLayout, error) {
+	file, err := os.Open(xkbRulesPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading the XKB layouts (is xkeyboard-config installed?): %w", err)
+	}
+	defer file.Close()
+	layouts, err := parseXKBRules(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", xkbRulesPath, err)
+	}
+	return layouts, nil
+}
+
+func newKeyboardForm(source, home string, prof profile, layouts []xkbLayout, deploy bool, page int) keyboardForm {
+	f := keyboardForm{source: source, home: home, profile: prof, layouts: layouts, deploy: deploy}
+	for i, layout := range layouts {
+		if layout.Name == prof.KbLayout {
+			f.cursor = i
+		}
+	}
+	f.offset = max(f.cursor-page/2, 0)
+	return f
+}
+
+// visible returns the layouts matching the filter.
+func (f keyboardForm) visible() []xkbLayout {
+	if f.filter == "" {
+		return f.layouts
+	}
+	var layouts []xkbLayout
+	filter := strings.ToLower(f.filter)
+	for _, layout := range f.layouts {
+		if strings.Contains(layout.Name, filter) || strings.Contains(strings.ToLower(layout.Description), filter) {
+			layouts = append(layouts, layout)
+		}
+	}
+	return layouts
+}
+
+// update handles a key and reports whether the form is done.
+func (f keyboardForm) update(msg tea.KeyMsg, page int) (keyboardForm, bool, tea.Cmd) {
+	if msg.Type == tea.KeyCtrlC {
+		return f, true, tea.Quit
+	}
+	if f.layout != nil {
+		return f.updateVariants(msg)
+	}
+
+	layouts := f.visible()
+	switch msg.Type {
+	case tea.KeyEsc:
+		if f.filter == "" {
+			return f, true, nil
+		}
+		f.filter, f.cursor, f.offset = "", 0, 0
+	case tea.KeyUp:
+		f.cursor = max(f.cursor-1, 0)
+	case tea.KeyDown:
+		f.cursor = min(f.cursor+1, len(layouts)-1)
+	case tea.KeyPgUp:
+		f.cursor = max(f.cursor-page, 0)
+	case tea.KeyPgDown:
+		f.cursor = min(f.cursor+page, len(layouts)-1)
+	case tea.KeyBackspace:
+		if f.filter != "" {
+			f.filter = f.filter[:len(f.filter)-1]
+			f.cursor, f.offset = 0, 0
+		}
+	case tea.KeyRunes:
+		f.filter += string(msg.Runes)
+		f.cursor, f.offset = 0, 0
+	case tea.KeyEnter:
+		if len(layouts) == 0 {
+			break
+		}
+		layout := layouts[f.cursor]
+		f.layout, f.variant = &layout, 0
+		for i, variant := range layout.Variants {
+			if layout.Name == f.profile.KbLayout && variant.Name == f.profile.KbVariant {
+				f.variant = i + 1
+			}
+		}
+	}
+	f.cursor = max(min(f.cursor, len(f.visible())-1), 0)
+	if f.cursor < f.offset {
+		f.offset = f.cursor
+	} else if f.cursor >= f.offset+page {
+		f.offset = f.cursor - page + 1
+	}
+	return f, false, nil
+}
+
+// updateVariants handles keys on the variants of a layout. The first entry
+// is the layout without a variant.
+func (f keyboardForm) updateVariants(msg tea.KeyMsg) (keyboardForm, bool, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return f, true, nil
+	case "esc", "left", "h":
+		f.layout = nil
+	case "up", "k":
+		f.variant = max(f.variant-1, 0)
+	case "down", "j":
+		f.variant = min(f.variant+1, len(f.layout.Variants))
+	case "enter":
+		variant := ""
+		if f.variant > 0 {
+			variant = f.layout.Variants[f.variant-1].Name
+		}
+		f.message, f.warnings, f.err = f.choose(f.layout.Name, variant)
+		if f.err == nil {
+			f.layout = nil
+		}
+	}
+	return f, false, nil
+}
+
+// choose saves the layout to the profile with its keybindings, renders
+// keyboard.conf and keybinding.conf into $HOME if deploying and Hyprland's
+// config is there, and checks the workspace binds, with those of
+// custom.conf, against the layout.
+func (f *keyboardForm) choose(layout, variant string) (string, []string, error) {
+	prof := f.profile
+	prof.KbLayout, prof.KbVariant = layout, variant
+	prof.Keyboard = keybindingsFor(f.source, layout, variant)
+	if err := prof.validate(f.source); err != nil {
+		return "", nil, err
+	}
+	if err := prof.save(); err != nil {
+		return "", nil, err
+	}
+	f.profile = prof
+
+	message := fmt.Sprintf("Saved %s with the %s keybindings to the profile, they are written with the dotfiles", layout, prof.Keyboard)
+	for _, rel := range []string{hyprConfDir + "/keyboard.conf", hyprConfDir + "/keybinding.conf"} {
+		if !f.deploy {
+			break
+		}
+		written, err := writeRendered(f.source, f.home, prof, rel)
+		if err != nil {
+			return "", nil, err
+		}
+		if written {
+			message = fmt.Sprintf("✅ Wrote %s with the %s keybindings to ~/%s", layout, prof.Keyboard, hyprConfDir)
+		}
+	}
+
+	binds, err := loadKeybindings(f.source, f.home, prof.Keyboard)
+	if err != nil {
+		return "", nil, err
+	}
+	return message, checkWorkspaceBinds(binds, layout, variant), nil
+}
+
+func (f keyboardForm) view(page int) string {
+	var result strings.Builder
+
+	if f.layout != nil {
+		result.WriteString(titleStyle.Render("⌨️  " + f.layout.Description))
+		result.WriteString("\n")
+		options := []string{"No variant"}
+		for _, variant := range f.layout.Variants {
+			options = append(options, fmt.Sprintf("%-20s %s", variant.Name, variant.Description))
+		}
+		start := max(min(f.variant-page/2, len(options)-page), 0)
+		end := min(start+page, len(options))
+		for i := start; i < end; i++ {
+			if i == f.variant {
+				result.WriteString(selectedStyle.Render("▶ " + options[i]))
+			} else {
+				result.WriteString(unselectedStyle.Render("  " + options[i]))
+			}
+			result.WriteString("\n")
+		}
+		if f.err != nil {
+			result.WriteString("\n")
+			result.WriteString(errorStyle.Render(f.err.Error()))
+			result.WriteString("\n")
+		}
+		result.WriteString("\nUse ↑↓ to navigate, ENTER to choose, ESC to go back")
+		return result.String()
+	}
+
+	result.WriteString(titleStyle.Render("⌨️  Keyboard Layout"))
+	result.WriteString("\n")
+	current := f.profile.KbLayout
+	if f.profile.KbVariant != "" {
+		current += "(" + f.profile.KbVariant + ")"
+	}
+	result.WriteString(descriptionStyle.Render(fmt.Sprintf("Current: %s with the %s keybindings. Filter: %s█", current, f.profile.Keyboard, f.filter)))
+	result.WriteString("\n\n")
+
+	layouts := f.visible()
+	end := min(f.offset+page, len(layouts))
+	for i := f.offset; i < end; i++ {
+		line := fmt.Sprintf("%-8s %s", layouts[i].Name, layouts[i].Description)
+		if i == f.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else {
+			result.WriteString(unselectedStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+	if len(layouts) == 0 {
+		result.WriteString("No layout matches the filter.\n")
+	}
+
+	if f.message != "" {
+		result.WriteString("\n")
+		result.WriteString(successStyle.Render(f.message))
+		result.WriteString("\n")
+	}
+	if len(f.warnings) > 0 {
+		result.WriteString(warningStyle.Render(fmt.Sprintf("⚠️  %d workspace bind(s) won't work with this layout:", len(f.warnings))))
+		result.WriteString("\n")
+		for _, warning := range f.warnings[:min(len(f.warnings), 5)] {
+			result.WriteString("  " + warning + "\n")
+		}
+		if len(f.warnings) > 5 {
+			result.WriteString(fmt.Sprintf("  and %d more\n", len(f.warnings)-5))
+		}
+	}
+	result.WriteString("\nType to filter, ↑↓ to navigate, ENTER to pick the variant, ESC to go back")
+	return result.String()
+}
+
+// updateKeyboardForm handles keys on the keyboard screen of the dotfiles
+// review, which rescans the dotfiles with the chosen layout.
+func (m model) updateKeyboardForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	form, done, cmd := m.keyboard.update(msg, m.listHeight())
+	m.keyboard = form
+	if done && cmd == nil {
+		m.editingKeyboard = false
+		m.review.profile.KbLayout = form.profile.KbLayout
+		m.review.profile.KbVariant = form.profile.KbVariant
+		m.review.profile.Keyboard = form.profile.Keyboard
+		m.review = m.review.rescan(m.review.mode)
+	}
+	return m, cmd
+}
+
+// keyboardModel is the keyboard form on its own.
+type keyboardModel struct {
+	form   keyboardForm
+	height int
+}
+
+func (m keyboardModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m keyboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		form, done, _ := m.form.update(msg, m.listHeight())
+		m.form = form
+		if done {
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m keyboardModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-12, 5)
+}
+
+func (m keyboardModel) View() string {
+	return m.form.view(m.listHeight())
+}
+
+// keyboardCommand implements `dotfiles-installer keyboard`.
+func keyboardCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: dotfiles-installer keyboard")
+	}
+
+	source, err := filepath.Abs(dotfilesSourceDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	prof, err := loadProfile()
+	if err != nil {
+		return err
+	}
+
+	layouts, err := loadXKBLayouts()
+	if err != nil {
+		return err
+	}
+
+	m := keyboardModel{}
+	m.form = newKeyboardForm(source, home, prof, layouts, true, m.listHeight())
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// hyprMouseKeys names the mouse buttons and wheel of the binds.
+var hyprMouseKeys = map[string]string{
+	"mouse:272":  "Left button",
+	"mouse:273":  "Right button",
+	"mouse:274":  "Middle button",
+	"mouse_down": "Wheel down",
+	"mouse_up":   "Wheel up",
+}
+
+// combo returns the keys to press, such as "SUPER + SHIFT + Q".
+func (b hyprBind) combo() string {
+	keys := strings.Fields(b.Mods)
+	if name, ok := hyprMouseKeys[b.Key]; ok {
+		keys = append(keys, name)
+	} else {
+		keys = append(keys, b.Key)
+	}
+	return strings.Join(keys, " + ")
+}
+
+// description returns the comment of the bind, or what it runs.
+func (b hyprBind) description() string {
+	if b.Comment != "" {
+		return b.Comment
+	}
+	return strings.TrimSpace(b.Dispatcher + " " + b.Arg)
+}
+
+// loadKeybindings reads the binds of a keybinding preset of the checkout
+// and of custom.conf, which Hyprland loads after it. The custom.conf in
+// $HOME is read if there is one, since it is the place for local binds.
+func loadKeybindings(source, home, preset string) ([]hyprBind, error) {
+	custom := filepath.Join(home, hyprConfDir, "custom.conf")
+	if _, err := os.Stat(custom); err != nil {
+		custom = filepath.Join(source, hyprConfDir, "custom.conf")
+	}
+	files := []struct{ name, path string }{
+		{"keybindings/" + preset + ".conf", filepath.Join(source, hyprConfDir, "keybindings", preset+".conf")},
+		{"custom.conf", custom},
+	}
+
+	var binds []hyprBind
+	vars := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file.path)
+		if os.IsNotExist(err) && file.name == "custom.conf" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		hyprVariables(data, vars)
+		for _, bind := range parseHyprBinds(data) {
+			bind.File = file.name
+			binds = append(binds, bind.expand(vars))
+		}
+	}
+	return binds, nil
+}
+
+// keysModel is a searchable cheat sheet of the keybindings.
+type keysModel struct {
+	preset string
+	binds  []hyprBind
+	// groups are the headings of the binds, in order; group 0 is all of
+	// them
+	groups []string
+	group  int
+	filter string
+	cursor int
+	offset int
+	height int
+}
+
+func newKeysModel(preset string, binds []hyprBind) keysModel {
+	m := keysModel{preset: preset, binds: binds, groups: []string{"All"}}
+	for _, bind := range binds {
+		if bind.Group != "" && !slices.Contains(m.groups, bind.Group) {
+			m.groups = append(m.groups, bind.Group)
+		}
+	}
+	return m
+}
+
+// visible returns the binds of the group matching the filter.
+func (m keysModel) visible() []hyprBind {
+	filter := strings.ToLower(m.filter)
+	var binds []hyprBind
+	for _, bind := range m.binds {
+		if m.group > 0 && bind.Group != m.groups[m.group] {
+			continue
+		}
+		text := strings.ToLower(bind.combo() + " " + bind.description() + " " + bind.Dispatcher + " " + bind.Arg)
+		if strings.Contains(text, filter) {
+			binds = append(binds, bind)
+		}
+	}
+	return binds
+}
+
+func (m keysModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m keysModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		page := m.listHeight()
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return m, tea.Quit
+		case tea.KeyEsc:
+			if m.filter == "" {
+				return m, tea.Quit
+			}
+			m.filter, m.cursor = "", 0
+		case tea.KeyTab:
+			m.group, m.cursor = (m.group+1)%len(m.groups), 0
+		case tea.KeyShiftTab:
+			m.group, m.cursor = (m.group-1+len(m.groups))%len(m.groups), 0
+		case tea.KeyUp:
+			m.cursor = max(m.cursor-1, 0)
+		case tea.KeyDown:
+			m.cursor++
+		case tea.KeyPgUp:
+			m.cursor = max(m.cursor-page, 0)
+		case tea.KeyPgDown:
+			m.cursor += page
+		case tea.KeyBackspace:
+			if runes := []rune(m.filter); len(runes) > 0 {
+				m.filter, m.cursor = string(runes[:len(runes)-1]), 0
+			}
+		case tea.KeySpace:
+			m.filter, m.cursor = m.filter+" ", 0
+		case tea.KeyRunes:
+			m.filter, m.cursor = m.filter+string(msg.Runes), 0
+		}
+		m.cursor = max(min(m.cursor, len(m.visible())-1), 0)
+		if m.cursor < m.offset {
+			m.offset = m.cursor
+		} else if m.cursor >= m.offset+page {
+			m.offset = m.cursor - page + 1
+		}
+	}
+	return m, nil
+}
+
+func (m keysModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-10, 5)
+}
+
+func (m keysModel) View() string {
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("⌨️  Keybindings"))
+	result.WriteString("\n")
+	result.WriteString(descriptionStyle.Render(fmt.Sprintf("keybindings/%s.conf and custom.conf. Group: %s. Filter: %s█", m.preset, m.groups[m.group], m.filter)))
+	result.WriteString("\n\n")
+
+	binds := m.visible()
+	end := min(m.offset+m.listHeight(), len(binds))
+	for i := m.offset; i < end; i++ {
+		bind := binds[i]
+		line := fmt.Sprintf("%-30s %-12s %s", bind.combo(), bind.Group, bind.description())
+		if i == m.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else {
+			result.WriteString(unselectedStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+	if len(binds) == 0 {
+		result.WriteString("No keybinding matches the filter.\n")
+	} else {
+		bind := binds[m.cursor]
+		result.WriteString("\n")
+		fields := []string{bind.Mods, bind.Key, bind.Dispatcher}
+		if bind.Arg != "" {
+			fields = append(fields, bind.Arg)
+		}
+		result.WriteString(descriptionStyle.Render(fmt.Sprintf("%s:%d: %s = %s", bind.File, bind.Line, bind.Kind, strings.Join(fields, ", "))))
+		result.WriteString("\n")
+	}
+	result.WriteString("\nType to search, TAB to change the group, ↑↓ to navigate, ESC to quit")
+	return result.String()
+}
+
+// keysCommand implements `dotfiles-installer keys`.
+func keysCommand(args []string) error {
+	flags := flag.NewFlagSet("keys", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the keybindings as JSON")
+	preset := flags.String("preset", "", "the keybinding preset, instead of the one of the profile")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("usage: dotfiles-installer keys [--json] [--preset name]")
+	}
+
+	source, err := filepath.Abs(dotfilesSourceDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	if *preset == "" {
+		prof, err := loadProfile()
+		if err != nil {
+			return err
+		}
+		*preset = prof.Keyboard
+	}
+	if names := presets(source, hyprConfDir+"/keybindings"); !slices.Contains(names, *preset) {
+		return fmt.Errorf("no keybinding preset %q, the presets are %s", *preset, strings.Join(names, ", "))
+	}
+	binds, err := loadKeybindings(source, home, *preset)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(binds, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	p := tea.NewProgram(newKeysModel(*preset, binds), tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
@@ -130,30 +130,3 @@ configure_sddm_settings() {
         echo "⚠️  Warning: SDDM theme configuration file not found in share directory"
     fi
 }
-
-    git clone "$SDDM_THEME_REPO" ~/sequoia && rm -rf ~/sequoia/.git
-    sudo mv ~/sequoia "$SDDM_THEME_PATH"
-
-    # Create the backgrounds directory in the theme if it doesn't exist
-    if [ -d "$SDDM_ASSET_FOLDER" ]; then
-        echo ":: Sequoia theme backgrounds directory already exists, removing old version"
-        sudo rm -rf "$SDDM_ASSET_FOLDER"
-    fi
-
-    echo ":: Creating SDDM theme backgrounds directory"
-    sudo mkdir -p "$SDDM_ASSET_FOLDER"
-
-    # Copy the wallpaper from our share directory to SDDM theme
-    echo ":: Copying wallpaper to SDDM theme"
-    sudo cp "$SDDM_WALLPAPERS_DIR/Solitary-Glow.png" "$SDDM_ASSET_FOLDER/current_wallpaper.jpg"
-    echo ":: Default wallpaper copied to SDDM theme folder"
-
-    # Copy our SDDM configurations
-    echo ":: Copying SDDM configuration files"
-            sudo cp share/sddm/sddm.conf "$SDDM_CONFIG_DIR/"
-    sudo cp share/sddm/theme.conf "$SDDM_THEME_PATH/theme.conf"
-
-    # Enable SDDM service
-    sudo systemctl enable sddm.service
-    echo ":: SDDM service enabled"
-}
@@ -201,9 +201,12 @@ _installPackages() {
         # Refresh sudo timestamp to prevent timeout
         sudo -v
         
-        # Update package database first
-        if ! sudo pacman -Sy; then
-            echo "⚠️  Warning: Failed to update package database"
+        # Update package database first, unless the planned transaction
+        # already synced it during this run
+        if [[ "${PACKAGES_SYNCED:-}" != "1" ]]; then
+            if ! sudo pacman -Sy; then
+                echo "⚠️  Warning: Failed to update package database"
+            fi
         fi
         
         # Install packages
@@ -219,6 +222,30 @@ _installPackages() {
     fi
 }
 
+# Install the deduplicated packages of all selected steps in a single
+# transaction. The full upgrade avoids partial upgrades, and PACKAGES_SYNCED
+# lets later _installPackages calls skip their own database refresh.
+install_package_transaction() {
+    if [[ $# -eq 0 ]]; then
+        echo "❌ Error: No packages specified for the package transaction"
+        return 1
+    fi
+
+    echo "🚀 Installing $# package(s) in a single transaction..."
+
+    # Refresh sudo timestamp to prevent timeout
+    sudo -v
+
+    if sudo pacman -Syu --needed --noconfirm "$@"; then
+        export PACKAGES_SYNCED=1
+        echo "✅ Package transaction completed successfully"
+    else
+        echo "❌ Package transaction failed, steps will install their own packages"
+        FAILED_STEPS+=("pacman transaction")
+        return 1
+    fi
+}
+
 # =============================================================================
 # SYSTEM MODIFICATION FUNCTIONS
 # =============================================================================
@@ -384,6 +411,9 @@ report_installation_summary() {
         echo "   3. Customize settings in ~/.config/hypr/"
         echo ""
         echo "📂 Backup location: $BACKUP_DIR"
+        if [[ -n "${RUN_DIR:-}" ]]; then
+            echo "📄 Installation report: $RUN_DIR/report.md"
+        fi
         return 0
     else
         echo "⚠️  Installation completed with ${#FAILED_STEPS[@]} issue(s):"
@@ -391,8 +421,13 @@ report_installation_summary() {
             echo "   ❌ $step"
         done
         echo ""
-        echo "📋 Check the installation log for details: ~/install.log"
+        if [[ -n "${RUN_DIR:-}" ]]; then
+            echo "📋 Check the installation logs for details: $RUN_DIR/logs"
+        fi
         echo "📂 System backups available at: $BACKUP_DIR"
+        if [[ -n "${RUN_DIR:-}" ]]; then
+            echo "📄 Installation report: $RUN_DIR/report.md"
+        fi
         echo ""
         echo "🔧 You may need to manually resolve these issues before proceeding."
         return 1
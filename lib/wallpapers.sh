@@ -18,18 +18,27 @@ readonly CACHE_DIR="$HOME/.config/ml4w/cache"
 setup_wallpapers() {
     echo "🖼️  Setting up wallpapers..."
 
-    # Create secure temporary directory
-    local temp_dir
-    temp_dir=$(create_temp_dir)
-    
-    echo "📁 Using temporary directory: $temp_dir"
+    local repo_dir
 
-    # Clone the wallpapers repository into temporary directory
-    echo "📥 Cloning wallpapers repository..."
-    if ! git clone "$WALLPAPER_REPO" "$temp_dir/wallpapers"; then
-        echo "❌ Error: Failed to clone wallpapers repository"
-        FAILED_STEPS+=("Wallpapers clone failed")
-        return 1
+    if [[ -d "${WALLPAPERS_PREFETCH_DIR:-}/.git" ]]; then
+        # The installer already cloned the repository in the background
+        echo "📦 Using prefetched wallpapers repository: $WALLPAPERS_PREFETCH_DIR"
+        repo_dir="$WALLPAPERS_PREFETCH_DIR"
+    else
+        # Create secure temporary directory
+        local temp_dir
+        temp_dir=$(create_temp_dir)
+        
+        echo "📁 Using temporary directory: $temp_dir"
+
+        # Clone the wallpapers repository into temporary directory
+        echo "📥 Cloning wallpapers repository..."
+        if ! git clone "$WALLPAPER_REPO" "$temp_dir/wallpapers"; then
+            echo "❌ Error: Failed to clone wallpapers repository"
+            FAILED_STEPS+=("Wallpapers clone failed")
+            return 1
+        fi
+        repo_dir="$temp_dir/wallpapers"
     fi
 
     # Ensure the target wallpaper directory exists
@@ -39,7 +48,7 @@ setup_wallpapers() {
     fi
 
     # Copy wallpapers from the cloned repository
-    local wallpapers_source="$temp_dir/wallpapers/share"
+    local wallpapers_source="$repo_dir/share"
     if [[ -d "$wallpapers_source" ]]; then
         echo "📋 Copying wallpapers to $TARGET_DIR/"
         if cp -r "$wallpapers_source"/* "$TARGET_DIR/"; then
@@ -91,6 +100,12 @@ setup_default_wallpaper() {
     fi
 }
 
+setup_pywal() {
+    echo "🎨 Setting up pywal..."
+
+    local default_wallpaper
+    default_wallpaper=$(cat "$CACHE_DIR/current_wallpaper" 2>/dev/null)
+
     # Check and install pywal if not available
     if ! _checkCommandExists wal; then
         echo "Installing pywal"
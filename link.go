@@ -0,0 +1,295 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// linkDotfiles symlinks the accepted files into $HOME. Like GNU stow, a
+// directory missing from $HOME is linked as a whole instead of file by
+// file. Files in the way are backed up and replaced, or adopted into the
+// checkout first.
+func linkDotfiles(files []dotfile, source, home string, backup *dotfileBackup, output func(string)) []string {
+	var failures []string
+	fail := func(file dotfile, format string, args ...any) {
+		output("❌ Error: " + fmt.Sprintf(format, args...))
+		failures = append(failures, "Dotfile "+file.Path)
+	}
+
+	var accepted []dotfile
+	rendered := 0
+	for _, file := range files {
+		if file.Action == dotfileSkip || file.State == dotfileIdentical || file.State == dotfileLinked {
+			continue
+		}
+		// Templates can't be linked, their output is written instead
+		if file.Rendered != nil {
+			if _, err := writeDotfile(file, file.Target, backup, output); err != nil {
+				failures = append(failures, "Dotfile "+file.Path)
+			} else {
+				rendered++
+			}
+			continue
+		}
+
+		if file.State == dotfileConflict {
+			entry, err := backup.preserve(file.Target)
+			if err != nil {
+				fail(file, "Failed to back up %s, leaving it alone: %v", file.Target, err)
+				continue
+			}
+			if file.Action == dotfileAdopt {
+				if err := adoptDotfile(file); err != nil {
+					fail(file, "Failed to adopt %s: %v", file.Target, err)
+					continue
+				}
+				output(fmt.Sprintf("📥 Adopted %s into the checkout", file.Target))
+			}
+			if err := os.Remove(file.Target); err != nil {
+				fail(file, "Failed to replace %s: %v", file.Target, err)
+				continue
+			}
+			entry.LinkedTo = file.Source
+			if err := backup.add(entry); err != nil {
+				output(fmt.Sprintf("⚠️  Warning: %v", err))
+			}
+		}
+		accepted = append(accepted, file)
+	}
+
+	linked := 0
+	for _, link := range foldLinks(accepted, source, home) {
+		err := os.MkdirAll(filepath.Dir(link.Target), 0755)
+		if err == nil {
+			err = os.Symlink(link.Source, link.Target)
+		}
+		if err != nil {
+			fail(link, "Failed to link %s: %v", link.Target, err)
+			continue
+		}
+		// Conflicts were recorded when they were moved out of the way
+		if link.State != dotfileConflict {
+			entry := backupEntry{Path: link.Target, Reason: reasonLinked, LinkedTo: link.Source}
+			if err := backup.add(entry); err != nil {
+				output(fmt.Sprintf("⚠️  Warning: %v", err))
+			}
+		}
+		linked++
+	}
+
+	output(fmt.Sprintf("🔗 Created %d symlink(s) into %s", linked, source))
+	if rendered > 0 {
+		output(fmt.Sprintf("📋 Wrote %d rendered template(s)", rendered))
+	}
+	return failures
+}
+
+// foldLinks picks what to link: for every accepted file, the topmost of its
+// directories that is missing from $HOME and has every file of the checkout
+// below it accepted, or else the file itself.
+func foldLinks(accepted []dotfile, source, home string) []dotfile {
+	count := make(map[string]int)
+	for _, file := range accepted {
+		for dir := path.Dir(file.Path); dir != "."; dir = path.Dir(dir) {
+			count[dir]++
+		}
+	}
+	// Files skipped in the review or left out of it block their directories
+	blocked := make(map[string]bool)
+	for dir, n := range count {
+		if n != countFiles(filepath.Join(source, dir)) {
+			blocked[dir] = true
+		}
+	}
+
+	var links []dotfile
+	folded := make(map[string]bool)
+	for _, file := range accepted {
+		top := ""
+		// Parents of an existing or blocked directory are existing or
+		// blocked as well
+		for dir := path.Dir(file.Path); dir != "."; dir = path.Dir(dir) {
+			if blocked[dir] {
+				break
+			}
+			if _, err := os.Lstat(filepath.Join(home, dir)); err == nil {
+				break
+			}
+			top = dir
+		}
+
+		if top == "" {
+			links = append(links, file)
+		} else if !folded[top] {
+			folded[top] = true
+			links = append(links, dotfile{
+				Path:   top,
+				Source: filepath.Join(source, top),
+				Target: filepath.Join(home, top),
+				State:  dotfileNew,
+			})
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Path < links[j].Path })
+	return links
+}
+
+func countFiles(dir string) int {
+	n := 0
+	filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// adoptDotfile moves the content of the file in $HOME into the checkout, so
+// that the link keeps what the user had and git shows the difference.
+func adoptDotfile(file dotfile) error {
+	info, err := os.Lstat(file.Target)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", file.Target)
+	}
+	content, err := os.ReadFile(file.Target)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file.Source, content, info.Mode().Perm())
+}
+
+// findLinks lists the symlinks in home that point into the checkout.
+func findLinks(source, home string) ([]string, error) {
+	root, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []string
+	err = filepath.WalkDir(source, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, p)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		target := filepath.Join(home, rel)
+		info, err := os.Lstat(target)
+		if err != nil {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return nil
+		}
+
+		if dest, err := filepath.EvalSymlinks(target); err == nil && (dest == root || strings.HasPrefix(dest, root+string(filepath.Separator))) {
+			links = append(links, target)
+		}
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return links, err
+}
+
+// copyInPlace replaces a symlink by a copy of what it points to.
+func copyInPlace(link string) error {
+	dest, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(link); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(dest, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dest, p)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(filepath.Join(link, rel), content, info.Mode().Perm())
+	})
+}
+
+// unlinkCommand implements `dotfiles-installer unlink [--copy]`, removing
+// the symlinks symlink mode created.
+func unlinkCommand(args []string) error {
+	flags := flag.NewFlagSet("unlink", flag.ContinueOnError)
+	keepCopies := flags.Bool("copy", false, "replace the symlinks by copies of the files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("usage: dotfiles-installer unlink [--copy]")
+	}
+
+	source, err := filepath.Abs(dotfilesSourceDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	links, err := findLinks(source, home)
+	if err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		fmt.Println("No symlinks into the dotfiles checkout found.")
+		return nil
+	}
+
+	failed := 0
+	for _, link := range links {
+		if *keepCopies {
+			err = copyInPlace(link)
+		} else {
+			err = os.Remove(link)
+		}
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", link, err)
+			failed++
+		} else if *keepCopies {
+			fmt.Printf("📄 Copied %s\n", link)
+		} else {
+			fmt.Printf("🔗 Unlinked %s\n", link)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d symlinks could not be removed", failed, len(links))
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	logsDirName    = "logs"
+	installLogName = "install.log"
+
+	// keepLogsEnv overrides how many runs keep their logs.
+	keepLogsEnv     = "DOTFILES_INSTALLER_KEEP_LOGS"
+	defaultKeepLogs = 10
+)
+
+// runLogs writes the output of a run to install.log and, while a unit is
+// running, to a log file of its own.
+type runLogs struct {
+	dir   string
+	mu    sync.Mutex
+	all   *os.File
+	unit  *os.File
+	units int
+}
+
+// openRunLogs creates the logs directory of a run.
+func openRunLogs(run *runState) (*runLogs, error) {
+	dir := run.logsDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating logs directory: %w", err)
+	}
+
+	all, err := os.OpenFile(filepath.Join(dir, installLogName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("creating install log: %w", err)
+	}
+	return &runLogs{dir: dir, all: all}, nil
+}
+
+// startUnit sends the following output to the log of function as well. The
+// logs are numbered so that they sort in the order the units ran.
+func (l *runLogs) startUnit(function string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closeUnit()
+	l.units++
+	name := fmt.Sprintf("%02d-%s.log", l.units, function)
+	unit, err := os.OpenFile(filepath.Join(l.dir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("creating step log: %w", err)
+	}
+	l.unit = unit
+	return nil
+}
+
+// endUnit stops writing to the current unit's log.
+func (l *runLogs) endUnit() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closeUnit()
+}
+
+func (l *runLogs) closeUnit() {
+	if l.unit != nil {
+		l.unit.Close()
+		l.unit = nil
+	}
+}
+
+// write appends a line of output to the logs. Logging is best effort and
+// never interrupts the installation.
+func (l *runLogs) write(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fmt.Fprintln(l.all, line)
+	if l.unit != nil {
+		fmt.Fprintln(l.unit, line)
+	}
+}
+
+func (l *runLogs) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closeUnit()
+	l.all.Close()
+}
+
+// keepLogs returns how many runs keep their logs. Zero keeps all of them.
+func keepLogs() int {
+	if value := os.Getenv(keepLogsEnv); value != "" {
+		if keep, err := strconv.Atoi(value); err == nil && keep >= 0 {
+			return keep
+		}
+	}
+	return defaultKeepLogs
+}
+
+// pruneLogs removes the logs of all but the keep most recent runs. Reports,
+// archived scripts and backups are never removed.
+func pruneLogs(keep int) error {
+	if keep == 0 {
+		return nil
+	}
+
+	ids, err := runIDs()
+	if err != nil {
+		return err
+	}
+	withLogs := 0
+	for i := len(ids) - 1; i >= 0; i-- {
+		dir, err := findRun(ids[i])
+		if err != nil {
+			return err
+		}
+		logs := filepath.Join(dir, logsDirName)
+		if _, err := os.Stat(logs); err != nil {
+			continue
+		}
+		if withLogs++; withLogs > keep {
+			if err := os.RemoveAll(logs); err != nil {
+				return fmt.Errorf("removing logs of run %s: %w", ids[i], err)
+			}
+		}
+	}
+	return nil
+}
+
+// runLogFiles lists the log files of a run, the full log first and then the
+// step logs in the order they ran.
+func runLogFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, logsDirName))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Name() != installLogName && strings.HasSuffix(entry.Name(), ".log") {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+	return append([]string{installLogName}, files...), nil
+}
+
+// logsModel browses the logs of past runs and opens them in a pager.
+type logsModel struct {
+	runs   []string
+	run    string
+	files  []string
+	cursor int
+	err    error
+}
+
+type pagerClosedMsg struct{ err error }
+
+func (m logsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m logsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case pagerClosedMsg:
+		m.err = msg.err
+	case tea.KeyMsg:
+		m.err = nil
+		items := m.runs
+		if m.run != "" {
+			items = m.files
+		}
+
+		switch msg.String() {
+		case "ctrl+c", "q":
+			return m, tea.Quit
+		case "esc":
+			if m.run == "" {
+				return m, tea.Quit
+			}
+			m.cursor = indexOf(m.runs, m.run)
+			m.run, m.files = "", nil
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(items)-1 {
+				m.cursor++
+			}
+		case "enter":
+			if len(items) == 0 {
+				return m, nil
+			}
+			if m.run == "" {
+				return m.openRun(m.runs[m.cursor]), nil
+			}
+			return m, m.openFile(m.files[m.cursor])
+		}
+	}
+	return m, nil
+}
+
+func (m logsModel) openRun(id string) logsModel {
+	dir, err := findRun(id)
+	if err == nil {
+		m.files, err = runLogFiles(dir)
+	}
+	if err != nil {
+		m.err = err
+		return m
+	}
+	m.run, m.cursor = id, 0
+	return m
+}
+
+// openFile shows a log in $PAGER, falling back to less.
+func (m logsModel) openFile(name string) tea.Cmd {
+	dir, err := findRun(m.run)
+	if err != nil {
+		return func() tea.Msg { return pagerClosedMsg{err} }
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+	}
+	cmd := exec.Command("sh", "-c", pager+` "$1"`, "sh", filepath.Join(dir, logsDirName, name))
+	return tea.ExecProcess(cmd, func(err error) tea.Msg { return pagerClosedMsg{err} })
+}
+
+func (m logsModel) View() string {
+	var result strings.Builder
+	if m.run == "" {
+		result.WriteString(titleStyle.Render("📝 Installer Runs"))
+		result.WriteString("\n")
+		if len(m.runs) == 0 {
+			result.WriteString(descriptionStyle.Render("No runs with logs found."))
+			result.WriteString("\n")
+		}
+		for i, id := range m.runs {
+			line := id
+			if dir, err := findRun(id); err == nil {
+				if report, err := loadRunReport(dir); err == nil {
+					line += "  " + report.summary()
+				}
+			}
+			result.WriteString(listItem(line, i == m.cursor))
+		}
+		result.WriteString("\nUse ↑↓ to select a run, ENTER to show its logs, 'q' to quit")
+	} else {
+		result.WriteString(titleStyle.Render("📝 Logs of run " + m.run))
+		result.WriteString("\n")
+		for i, name := range m.files {
+			result.WriteString(listItem(name, i == m.cursor))
+		}
+		result.WriteString("\nUse ↑↓ to select a log, ENTER to open it, ESC to go back, 'q' to quit")
+	}
+
+	if m.err != nil {
+		result.WriteString("\n\n")
+		result.WriteString(errorStyle.Render(m.err.Error()))
+	}
+	return result.String()
+}
+
+func listItem(text string, selected bool) string {
+	if selected {
+		return selectedStyle.Render("▶ "+text) + "\n"
+	}
+	return unselectedStyle.Render("  "+text) + "\n"
+}
+
+func indexOf(items []string, item string) int {
+	for i, candidate := range items {
+		if candidate == item {
+			return i
+		}
+	}
+	return 0
+}
+
+// logsCommand implements `dotfiles-installer logs [run [log]]`. Without
+// arguments it browses the runs; otherwise it prints the path of a run's
+// logs directory or of one of its logs.
+func logsCommand(args []string) error {
+	switch len(args) {
+	case 0:
+		ids, err := runIDs()
+		if err != nil {
+			return err
+		}
+		// Newest first, and only runs whose logs were kept
+		var runs []string
+		for i := len(ids) - 1; i >= 0; i-- {
+			if dir, err := findRun(ids[i]); err == nil {
+				if _, err := os.Stat(filepath.Join(dir, logsDirName)); err == nil {
+					runs = append(runs, ids[i])
+				}
+			}
+		}
+		p := tea.NewProgram(logsModel{runs: runs}, tea.WithAltScreen())
+		_, err = p.Run()
+		return err
+	case 1, 2:
+		dir, err := findRun(args[0])
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, logsDirName)
+		if len(args) == 2 {
+			files, err := runLogFiles(dir)
+			if err != nil {
+				return err
+			}
+			path = ""
+			for _, name := range files {
+				if name == args[1] || strings.TrimSuffix(name[strings.Index(name, "-")+1:], ".log") == args[1] {
+					path = filepath.Join(dir, logsDirName, name)
+				}
+			}
+			if path == "" {
+				return fmt.Errorf("run %s has no log for %s", args[0], args[1])
+			}
+		}
+		fmt.Println(path)
+		return nil
+	default:
+		return fmt.Errorf("usage: dotfiles-installer logs [run [step]]")
+	}
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -74,6 +73,10 @@ type InstallStep struct {
 	Function    string
 	Selected    bool
 	Required    bool
+	// Config is the directory a dotfiles sub-item deploys, and Apps the
+	// steps whose selection it follows
+	Config string
+	Apps   []string
 }
 
 type Category struct {
@@ -93,6 +96,28 @@ type model struct {
 	warnings            []string
 	selectedSteps       map[string]bool
 	installationStarted bool
+	reviewingPlan       bool
+	reviewingDotfiles   bool
+	review              dotfilesReview
+	editingProfile      bool
+	form                profileForm
+	editingSettings     bool
+	settings            settingsForm
+	editingWaybar       bool
+	waybar              waybarForm
+	editingAutostart    bool
+	autostart           autostartForm
+	editingKeyboard     bool
+	keyboard            keyboardForm
+	editingMonitors     bool
+	monitors            monitorsForm
+	height              int
+	vm                  string
+	plan                installPlan
+	events              chan tea.Msg
+	prefetch            prefetchMsg
+	reportPath          string
+	logsDir             string
 }
 
 func initialModel() model {
@@ -227,11 +252,18 @@ func initialModel() model {
 				{Name: "Software Management", Description: "Flatpak support", Function: "install_software_management", Selected: false, Required: false},
 				{Name: "Fonts", Description: "Essential and programming fonts", Function: "install_fonts", Selected: true, Required: false},
 				{Name: "Zsh Shell", Description: "Z shell with plugins and configuration", Function: "setup_zsh", Selected: true, Required: false},
-				{Name: "Dotfiles", Description: "Copy configuration files", Function: "copy_dotfiles", Selected: true, Required: true},
 			},
 		},
 	}
 
+	// The Dotfiles step comes with one item per application configuration
+	categories = append(categories, Category{
+		Name: "Dotfiles",
+		Steps: append([]InstallStep{
+			{Name: "Dotfiles", Description: "Copy configuration files (shell, editor and the selected applications below)", Function: "copy_dotfiles", Selected: true, Required: true},
+		}, dotfilesConfigSteps(dotfilesSourceDir, categories)...),
+	})
+
 	selectedSteps := make(map[string]bool)
 	for _, category := range categories {
 		for _, step := range category.Steps {
@@ -239,11 +271,50 @@ func initialModel() model {
 		}
 	}
 
-	return model{
+	m := model{
 		categories:      categories,
 		currentCategory: 0,
 		currentStep:     0,
 		selectedSteps:   selectedSteps,
+		vm:              detectVM(),
+	}
+	// Configurations start out selected along with their applications
+	for _, category := range categories {
+		for _, step := range category.Steps {
+			for _, app := range step.Apps {
+				m.followApp(app)
+			}
+		}
+	}
+	return m
+}
+
+// setSelected selects or deselects a step.
+func (m model) setSelected(function string, selected bool) {
+	m.selectedSteps[function] = selected
+	for c := range m.categories {
+		for s := range m.categories[c].Steps {
+			if m.categories[c].Steps[s].Function == function {
+				m.categories[c].Steps[s].Selected = selected
+			}
+		}
+	}
+}
+
+// followApp selects the configurations belonging to an application step
+// when any of their applications is selected, and deselects them otherwise.
+func (m model) followApp(function string) {
+	for _, category := range m.categories {
+		for _, step := range category.Steps {
+			follows, selected := false, false
+			for _, app := range step.Apps {
+				follows = follows || app == function
+				selected = selected || m.selectedSteps[app]
+			}
+			if follows {
+				m.setSelected(step.Function, selected)
+			}
+		}
 	}
 }
 
@@ -265,6 +336,63 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 
+		if m.reviewingPlan {
+			switch msg.String() {
+			case "ctrl+c", "q":
+				return m, tea.Quit
+			case "esc":
+				m.reviewingPlan = false
+			case "e":
+				m.plan.Environment.Keep = !m.plan.Environment.Keep
+			case "enter":
+				m.reviewingPlan = false
+				if m.plan.hasStep(dotfilesStep) {
+					m.reviewingDotfiles = true
+					p, err := loadProfile()
+					// The review shows the proposed environment, which is
+					// only saved once the installation starts
+					if variant := m.plan.environmentVariant(); variant != "" {
+						p.setVariant("environments", variant)
+					}
+					m.review = newDotfilesReview(deployCopy, m.excludedConfigs(), append(m.plan.RepoPackages, m.plan.AURPackages...), p, "")
+					if err != nil {
+						m.review.err = err
+					}
+					return m, nil
+				}
+				return m.beginInstallation()
+			}
+			return m, nil
+		}
+
+		if m.editingProfile {
+			return m.updateProfileForm(msg)
+		}
+
+		if m.editingSettings {
+			return m.updateSettingsForm(msg)
+		}
+
+		if m.editingWaybar {
+			return m.updateWaybarForm(msg)
+		}
+
+		if m.editingAutostart {
+			return m.updateAutostartForm(msg)
+		}
+
+		if m.editingKeyboard {
+			return m.updateKeyboardForm(msg)
+		}
+
+		if m.editingMonitors {
+			return m.updateMonitorsForm(msg)
+		}
+
+		if m.reviewingDotfiles {
+			return m.updateDotfilesReview(msg)
+		}
+
 		switch msg.String() {
 		case "ctrl+c", "q":
 			return m, tea.Quit
@@ -295,16 +423,22 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "space", " ":
 			currentStep := m.categories[m.currentCategory].Steps[m.currentStep]
 			if !currentStep.Required {
-				m.selectedSteps[currentStep.Function] = !m.selectedSteps[currentStep.Function]
-				m.categories[m.currentCategory].Steps[m.currentStep].Selected = m.selectedSteps[currentStep.Function]
+				m.setSelected(currentStep.Function, !m.selectedSteps[currentStep.Function])
+				m.followApp(currentStep.Function)
 			}
 		case "enter":
 			if !m.installationStarted {
-				m.installing = true
-				m.installationStarted = true
-				return m, m.startInstallation()
+				m.plan = planInstallation(m.selectedStepList())
+				prof, _ := loadProfile()
+				m.plan.Environment = proposeEnvironment(dotfilesSourceDir, m.plan.Steps, m.vm, prof)
+				if home, err := os.UserHomeDir(); err == nil {
+					m.plan.Hypr = m.plan.checkHypr(home)
+				}
+				m.reviewingPlan = true
 			}
 		}
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
 	case installProgressMsg:
 		m.installProgress = string(msg)
 		return m, m.waitForInstallation()
@@ -321,6 +455,15 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case installWarningMsg:
 		m.warnings = append(m.warnings, string(msg))
 		return m, m.waitForInstallation()
+	case prefetchMsg:
+		m.prefetch = msg
+		return m, m.waitForInstallation()
+	case installReportMsg:
+		m.reportPath = string(msg)
+		return m, m.waitForInstallation()
+	case installLogsMsg:
+		m.logsDir = string(msg)
+		return m, m.waitForInstallation()
 	}
 
 	return m, nil
@@ -359,13 +502,57 @@ func (m model) View() string {
 				result.WriteString(errorStyle.Render("  • " + err))
 				result.WriteString("\n")
 			}
-			result.WriteString("\nCheck ~/install.log for details.\n")
+			result.WriteString("\nCheck the logs for details.\n")
+		}
+
+		if m.reportPath != "" || m.logsDir != "" {
+			result.WriteString("\n")
+		}
+		if m.reportPath != "" {
+			result.WriteString(descriptionStyle.Render("Report saved to " + m.reportPath))
+			result.WriteString("\n")
+		}
+		if m.logsDir != "" {
+			result.WriteString(descriptionStyle.Render("Logs saved to " + m.logsDir))
+			result.WriteString("\n")
 		}
 
 		result.WriteString("\nPress any key to exit...")
 		return result.String()
 	}
 
+	if m.reviewingPlan {
+		return m.planView()
+	}
+
+	if m.editingProfile {
+		return m.profileView()
+	}
+
+	if m.editingSettings {
+		return m.settings.view(m.listHeight())
+	}
+
+	if m.editingWaybar {
+		return m.waybar.view(m.listHeight())
+	}
+
+	if m.editingAutostart {
+		return m.autostart.view(m.listHeight())
+	}
+
+	if m.editingKeyboard {
+		return m.keyboard.view(m.listHeight())
+	}
+
+	if m.editingMonitors {
+		return m.monitors.view()
+	}
+
+	if m.reviewingDotfiles {
+		return m.dotfilesView()
+	}
+
 	if m.installing {
 		var result strings.Builder
 		result.WriteString(titleStyle.Render("📦 Installing Dotfiles..."))
@@ -381,6 +568,11 @@ func (m model) View() string {
 			result.WriteString("\n")
 		}
 
+		if len(m.prefetch) > 0 {
+			result.WriteString("\n")
+			result.WriteString(m.prefetch.view())
+		}
+
 		result.WriteString("\n")
 		result.WriteString("Please wait while the installation completes...\n")
 		result.WriteString("This may take several minutes depending on your internet connection.\n\n")
@@ -514,6 +706,21 @@ type installStepMsg string
 type installCompleteMsg struct{}
 type installErrorMsg string
 type installWarningMsg string
+type installReportMsg string
+type installLogsMsg string
+
+// beginInstallation leaves the review screens and starts installing.
+func (m model) beginInstallation() (tea.Model, tea.Cmd) {
+	if err := m.applyEnvironment(); err != nil {
+		m.warnings = append(m.warnings, fmt.Sprintf("Hyprland environment: %v", err))
+	}
+	m.reviewingPlan = false
+	m.reviewingDotfiles = false
+	m.installing = true
+	m.installationStarted = true
+	m.events = make(chan tea.Msg, 64)
+	return m, m.startInstallation()
+}
 
 func (m model) startInstallation() tea.Cmd {
 	return func() tea.Msg {
@@ -524,130 +731,206 @@ func (m model) startInstallation() tea.Cmd {
 }
 
 func (m model) waitForInstallation() tea.Cmd {
-	return tea.Tick(time.Millisecond*100, func(time.Time) tea.Msg {
-		return nil
-	})
-}
-
-func (m model) runInstallation() {
-	// Create install script content
-	var scriptContent strings.Builder
-	scriptContent.WriteString("#!/bin/bash\n\n")
-	scriptContent.WriteString("# Redirect output to log file (fixed to prevent race conditions)\n")
-	scriptContent.WriteString("LOG_FILE=\"$HOME/install.log\"\n")
-	scriptContent.WriteString("exec > >(tee \"$LOG_FILE\") 2>&1\n\n")
-	scriptContent.WriteString("FAILED_STEPS=()\n\n")
-
-	// Add source statements for required libraries
-	scriptContent.WriteString("# Load utilities and sub-scripts\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/utils.sh\"\n")
-	scriptContent.WriteString("init_utils\n\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/packages.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/aur.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/nvidia.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/apps.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/wallpapers.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/sddm.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/zsh.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/fastfetch.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/dotfiles.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/node.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/mongodb.sh\"\n")
-	scriptContent.WriteString("source \"$(pwd)/lib/virtualization.sh\"\n\n")
-
-	scriptContent.WriteString("# Execute selected installation steps\n")
-
-	// Add selected installation steps
-	for _, category := range m.categories {
-		for _, step := range category.Steps {
-			if step.Required || m.selectedSteps[step.Function] {
-				scriptContent.WriteString(fmt.Sprintf("echo \"=== Installing: %s ===\"\n", step.Name))
-				scriptContent.WriteString("set +e  # Allow individual steps to fail\n")
-				scriptContent.WriteString(fmt.Sprintf("%s\n", step.Function))
-				scriptContent.WriteString("STEP_EXIT_CODE=$?\n")
-				scriptContent.WriteString("if [ $STEP_EXIT_CODE -ne 0 ]; then\n")
-				scriptContent.WriteString(fmt.Sprintf("    echo \"❌ Warning: %s failed with exit code $STEP_EXIT_CODE\"\n", step.Name))
-				scriptContent.WriteString(fmt.Sprintf("    FAILED_STEPS+=(\"%s\")\n", step.Name))
-				scriptContent.WriteString("fi\n")
-				scriptContent.WriteString("set -e  # Re-enable exit on error\n")
-				scriptContent.WriteString("echo\n")
-			}
+	return func() tea.Msg {
+		msg, ok := <-m.events
+		if !ok {
+			return installCompleteMsg{}
 		}
+		return msg
 	}
+}
 
-	scriptContent.WriteString("\n# Installation complete\n")
-	scriptContent.WriteString("echo ''\n")
-	scriptContent.WriteString("echo '🎉 ================================'\n")
-	scriptContent.WriteString("echo '🎉  SETUP COMPLETE!'\n")
-	scriptContent.WriteString("echo '🎉 ================================'\n")
-	scriptContent.WriteString("echo ''\n")
-	scriptContent.WriteString("report_installation_summary\n")
+func (m model) runInstallation() {
+	defer close(m.events)
 
-	scriptContent.WriteString("# Exit with appropriate code (summary already handled)\n")
-	scriptContent.WriteString("if [ ${#FAILED_STEPS[@]} -gt 0 ]; then\n")
-	scriptContent.WriteString("    exit 1\n")
-	scriptContent.WriteString("else\n")
-	scriptContent.WriteString("    exit 0\n")
-	scriptContent.WriteString("fi\n")
+	run, err := newRunState()
+	if err != nil {
+		m.events <- installErrorMsg(fmt.Sprintf("Failed to create run directory: %v", err))
+		return
+	}
+	if err := run.linkLatest(); err != nil {
+		m.events <- installWarningMsg(err.Error())
+	}
 
-	// Write the install script
-	scriptPath := "/tmp/install_selected.sh"
-	err := os.WriteFile(scriptPath, []byte(scriptContent.String()), 0755)
+	logs, err := openRunLogs(run)
 	if err != nil {
-		fmt.Printf("Failed to create install script: %v\n", err)
+		m.events <- installErrorMsg(fmt.Sprintf("Failed to create logs: %v", err))
 		return
 	}
+	defer logs.close()
+	m.events <- installLogsMsg(run.logsDir())
+	if err := pruneLogs(keepLogs()); err != nil {
+		m.events <- installWarningMsg(fmt.Sprintf("Failed to remove old logs: %v", err))
+	}
 
-	// Execute the install script
-	cmd := exec.Command("bash", scriptPath)
-	cmd.Dir, _ = os.Getwd()
+	report := newRunReport(run, m.plan)
+	fail := func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		report.Errors = append(report.Errors, msg)
+		m.events <- installErrorMsg(msg)
+	}
+	defer func() {
+		report.finish(m.plan.units())
+		if err := report.write(run.Dir); err != nil {
+			m.events <- installErrorMsg(fmt.Sprintf("Failed to write report: %v", err))
+			return
+		}
+		m.events <- installReportMsg(filepath.Join(run.Dir, reportMarkdownName))
+	}()
 
-	// Get stdout pipe to read output in real-time
-	stdout, err := cmd.StdoutPipe()
+	// Stage the install script in a private directory and keep it for auditing
+	script, err := stageInstallScript([]byte(m.plan.script()))
 	if err != nil {
-		fmt.Printf("Failed to get stdout pipe: %v\n", err)
+		fail("Failed to create install script: %v", err)
 		return
 	}
+	defer func() {
+		if err := script.archive(run); err != nil {
+			fail("Failed to archive install script: %v", err)
+		}
+	}()
+
+	if err := script.verify(); err != nil {
+		fail("Refusing to run install script: %v", err)
+		return
+	}
+
+	sched := newScheduler(m.plan, filepath.Join(script.dir, "prefetch"), func(msg prefetchMsg) {
+		m.events <- msg
+	})
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		fmt.Printf("Failed to start installation: %v\n", err)
+	env := append(sched.env(),
+		"BACKUP_DIR="+run.backupDir(),
+		"RUN_DIR="+run.Dir,
+	)
+	output := func(line string) {
+		logs.write(line)
+		m.sendOutput(line)
+	}
+	runner, err := startStepRunner(script, env, output)
+	if err != nil {
+		fail("Failed to start installation: %v", err)
 		return
 	}
 
-	// Read output line by line
-	scanner := bufio.NewScanner(stdout)
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Parse different types of output
-		if strings.Contains(line, "=== Installing:") {
-			// Extract step name
-			stepName := strings.TrimSpace(strings.Replace(line, "=== Installing:", "", 1))
-			stepName = strings.TrimSpace(strings.Replace(stepName, "===", "", 1))
-			fmt.Printf("STEP: %s\n", stepName)
-		} else if strings.Contains(line, "ERROR") || strings.Contains(line, "error") {
-			fmt.Printf("ERROR: %s\n", line)
-		} else if strings.Contains(line, "WARNING") || strings.Contains(line, "warning") {
-			fmt.Printf("WARNING: %s\n", line)
+	units := make(map[string]installUnit)
+	for _, unit := range m.plan.units() {
+		units[unit.Function] = unit
+	}
+	ran := make(map[string]bool)
+	runUnit := func(function string) bool {
+		ran[function] = true
+		if err := logs.startUnit(function); err != nil {
+			m.events <- installWarningMsg(err.Error())
+		}
+		started := time.Now()
+		var result unitResult
+		ok := true
+		if step, native := nativeSteps[function]; native {
+			var lines []string
+			emit := func(line string) {
+				lines = append(lines, line)
+				output(line)
+			}
+			emit(fmt.Sprintf("=== Installing: %s ===", units[function].Name))
+			result = step(m, run, emit)
+			result.Output = lines
 		} else {
-			fmt.Printf("OUTPUT: %s\n", line)
+			result, ok = runner.run(function)
 		}
+		logs.endUnit()
+		report.record(units[function], started, result, ok)
+		return ok
 	}
 
-	// Wait for command to finish
-	err = cmd.Wait()
+	// Validate the system and obtain sudo before anything runs in the background
+	if runUnit(preflightUnit) {
+		// Download packages and clone repositories while configuration-only
+		// steps run in the foreground
+		sched.start()
+		alive := true
+		for _, step := range m.plan.foregroundSteps() {
+			if alive = runUnit(step.Function); !alive {
+				break
+			}
+		}
+
+		// Anything that installs waits for the downloads and keeps the plan order
+		sched.waitAll()
+		for _, unit := range m.plan.units() {
+			if !alive {
+				break
+			}
+			if !ran[unit.Function] {
+				alive = runUnit(unit.Function)
+			}
+		}
+	}
 
-	// Clean up
-	os.Remove(scriptPath)
+	if err := runner.finish(); err != nil {
+		m.events <- installErrorMsg(fmt.Sprintf("Installation completed with errors: %v", err))
+	}
+}
 
-	if err != nil {
-		fmt.Printf("Installation completed with errors: %v\n", err)
+// sendOutput forwards a line of script output to the TUI.
+func (m model) sendOutput(line string) {
+	// Parse different types of output
+	if strings.Contains(line, "=== Installing:") {
+		// Extract step name
+		stepName := strings.TrimSpace(strings.Replace(line, "=== Installing:", "", 1))
+		stepName = strings.TrimSpace(strings.Replace(stepName, "===", "", 1))
+		m.events <- installStepMsg(stepName)
+	} else if isErrorLine(line) {
+		m.events <- installErrorMsg(line)
+	} else if isWarningLine(line) {
+		m.events <- installWarningMsg(line)
 	} else {
-		fmt.Printf("Installation completed successfully\n")
+		m.events <- installProgressMsg(line)
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "report":
+			err = reportCommand(os.Args[2:])
+		case "logs":
+			err = logsCommand(os.Args[2:])
+		case "restore":
+			err = restoreCommand(os.Args[2:])
+		case "unlink":
+			err = unlinkCommand(os.Args[2:])
+		case "status":
+			err = statusCommand(os.Args[2:])
+		case "capture":
+			err = captureCommand(os.Args[2:])
+		case "variants":
+			err = variantsCommand(os.Args[2:])
+		case "monitors":
+			err = monitorsCommand(os.Args[2:])
+		case "keyboard":
+			err = keyboardCommand(os.Args[2:])
+		case "keys":
+			err = keysCommand(os.Args[2:])
+		case "hypr":
+			err = hyprCommand(os.Args[2:])
+		case "settings":
+			err = settingsCommand(os.Args[2:])
+		case "waybar":
+			err = waybarCommand(os.Args[2:])
+		case "autostart":
+			err = autostartCommand(os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q\nusage: dotfiles-installer [report [run] | logs [run [step]] | restore [run] | unlink [--copy] | status [--json] | capture | variants | monitors [--hyprctl file | --drm dir] | keyboard | keys [--json] [--preset name] | hypr check [--dotfiles] | settings | waybar [--dotfiles] | autostart [--dotfiles]]", os.Args[1])
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Check if we're in the right directory
 	if _, err := os.Stat("lib/packages.sh"); os.IsNotExist(err) {
 		fmt.Println("Error: Please run this installer from the dotfiles directory.")
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// dotfilesManifestName is the manifest at the root of share/dotfiles.
+const dotfilesManifestName = ".dotfiles.json"
+
+// mergeStrategy is how a shipped file is combined with the one already in
+// $HOME, for apps that keep their own state in their config.
+type mergeStrategy string
+
+const (
+	mergeOverwrite mergeStrategy = "overwrite"
+	// mergeJSON deep-merges objects, the shipped values winning
+	mergeJSON mergeStrategy = "json"
+	// mergeINI and mergeTOML replace or add the shipped keys, section by
+	// section, and leave the other lines alone
+	mergeINI  mergeStrategy = "ini"
+	mergeTOML mergeStrategy = "toml"
+	// mergeKeep only writes the file when there is none yet
+	mergeKeep mergeStrategy = "keep"
+)
+
+// dotfilesManifest declares per-path behaviour of the dotfiles.
+type dotfilesManifest struct {
+	// Merge maps paths, or path.Match patterns, to their strategy
+	Merge map[string]mergeStrategy `json:"merge"`
+}
+
+func loadDotfilesManifest(source string) (dotfilesManifest, error) {
+	var manifest dotfilesManifest
+	data, err := os.ReadFile(filepath.Join(source, dotfilesManifestName))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("parsing %s: %w", dotfilesManifestName, err)
+	}
+	for pattern, strategy := range manifest.Merge {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return manifest, fmt.Errorf("%s: invalid pattern %q", dotfilesManifestName, pattern)
+		}
+		switch strategy {
+		case mergeOverwrite, mergeJSON, mergeINI, mergeTOML, mergeKeep:
+		default:
+			return manifest, fmt.Errorf("%s: unknown merge strategy %q for %s", dotfilesManifestName, strategy, pattern)
+		}
+	}
+	return manifest, nil
+}
+
+// strategy returns how the file at rel is deployed. An exact path wins over
+// patterns.
+func (m dotfilesManifest) strategy(rel string) mergeStrategy {
+	if strategy, ok := m.Merge[rel]; ok {
+		return strategy
+	}
+	for pattern, strategy := range m.Merge {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return strategy
+		}
+	}
+	return mergeOverwrite
+}
+
+// mergeContent combines the shipped content want with the content have of
+// the file in $HOME.
+func mergeContent(strategy mergeStrategy, have, want []byte) ([]byte, error) {
+	switch strategy {
+	case mergeJSON:
+		return mergeJSONContent(have, want)
+	case mergeINI:
+		return mergeKeyLines(have, want, false), nil
+	case mergeTOML:
+		return mergeKeyLines(have, want, true), nil
+	case mergeKeep:
+		return have, nil
+	default:
+		return want, nil
+	}
+}
+
+// jsonObject is a JSON object that remembers the order of its keys, so that
+// a merge only shows the values that change.
+type jsonObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func mergeJSONContent(have, want []byte) ([]byte, error) {
+	haveValue, err := parseOrderedJSON(have)
+	if err != nil {
+		return nil, fmt.Errorf("existing file: %w", err)
+	}
+	wantValue, err := parseOrderedJSON(want)
+	if err != nil {
+		return nil, fmt.Errorf("shipped file: %w", err)
+	}
+
+	var out bytes.Buffer
+	writeOrderedJSON(&out, mergeJSONValues(haveValue, wantValue), jsonIndent(have), "")
+	if len(have) == 0 || bytes.HasSuffix(have, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// mergeJSONValues merges objects key by key. Anything else, arrays
+// included, is replaced by the shipped value.
+func mergeJSONValues(have, want any) any {
+	haveObject, ok := have.(*jsonObject)
+	wantObject, ok2 := want.(*jsonObject)
+	if !ok || !ok2 {
+		return want
+	}
+	for _, key := range wantObject.keys {
+		if _, exists := haveObject.values[key]; !exists {
+			haveObject.keys = append(haveObject.keys, key)
+			haveObject.values[key] = wantObject.values[key]
+			continue
+		}
+		haveObject.values[key] = mergeJSONValues(haveObject.values[key], wantObject.values[key])
+	}
+	return haveObject
+}
+
+func parseOrderedJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeOrderedJSON(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level value")
+	}
+	return value, nil
+}
+
+func decodeOrderedJSON(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		object := &jsonObject{values: make(map[string]any)}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := object.values[key.(string)]; !exists {
+				object.keys = append(object.keys, key.(string))
+			}
+			object.values[key.(string)] = value
+		}
+		_, err := decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := []any{}
+		for decoder.More() {
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := decoder.Token()
+		return array, err
+	default:
+		return token, nil
+	}
+}
+
+func writeOrderedJSON(out *bytes.Buffer, value any, indent, prefix string) {
+	switch value := value.(type) {
+	case *jsonObject:
+		if len(value.keys) == 0 {
+			out.WriteString("{}")
+			return
+		}
+		out.WriteString("{\n")
+		for i, key := range value.keys {
+			out.WriteString(prefix + indent)
+			writeJSONScalar(out, key)
+			out.WriteString(": ")
+			writeOrderedJSON(out, value.values[key], indent, prefix+indent)
+			if i < len(value.keys)-1 {
+				out.WriteByte(',')
+			}
+			out.WriteByte('\n')
+		}
+		out.WriteString(prefix + "}")
+	case []any:
+		if len(value) == 0 {
+			out.WriteString("[]")
+			return
+		}
+		out.WriteString("[\n")
+		for i, item := range value {
+			out.WriteString(prefix + indent)
+			writeOrderedJSON(out, item, indent, prefix+indent)
+			if i < len(value)-1 {
+				out.WriteByte(',')
+			}
+			out.WriteByte('\n')
+		}
+		out.WriteString(prefix + "]")
+	default:
+		writeJSONScalar(out, value)
+	}
+}
+
+func writeJSONScalar(out *bytes.Buffer, value any) {
+	var scalar bytes.Buffer
+	encoder := json.NewEncoder(&scalar)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	out.Write(bytes.TrimSuffix(scalar.Bytes(), []byte("\n")))
+}
+
+// jsonIndent guesses the indentation of a JSON file, defaulting to four
+// spaces.
+func jsonIndent(data []byte) string {
+	for _, line := range splitLines(data) {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != line && trimmed != "" {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "    "
+}
+
+// keyBlock is a line of an INI or TOML file with the lines that continue
+// it: a section header, a key with its value, or anything else.
+type keyBlock struct {
+	section string
+	key     string
+	header  bool
+	lines   []string
+}
+
+// parseKeyBlocks splits an INI or TOML file into blocks. TOML values may
+// span several lines as arrays, inline tables or multi-line strings.
+func parseKeyBlocks(data []byte, toml bool) []keyBlock {
+	var blocks []keyBlock
+	section := ""
+	lines := splitLines(data)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = strings.TrimSpace(strings.Trim(trimmed, "[]"))
+			blocks = append(blocks, keyBlock{section: section, header: true, lines: []string{line}})
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") || !strings.Contains(trimmed, "="):
+			blocks = append(blocks, keyBlock{section: section, lines: []string{line}})
+		default:
+			key, value, _ := strings.Cut(trimmed, "=")
+			block := keyBlock{section: section, key: strings.TrimSpace(key), lines: []string{line}}
+			if toml {
+				for open := tomlOpen(value); open && i+1 < len(lines); open = tomlOpen(value) {
+					i++
+					block.lines = append(block.lines, lines[i])
+					value += "\n" + lines[i]
+				}
+			}
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// tomlOpen reports whether a TOML value continues on the next line: an
+// unterminated multi-line string, array or inline table.
+func tomlOpen(value string) bool {
+	if strings.Count(value, `"""`)%2 == 1 || strings.Count(value, "'''")%2 == 1 {
+		return true
+	}
+	depth := 0
+	var quote rune
+	for _, c := range value {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return depth > 0
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// mergeKeyLines replaces the keys of have that want sets, adds the ones it
+// lacks to their section, and keeps everything else of have in place.
+func mergeKeyLines(have, want []byte, toml bool) []byte {
+	result := parseKeyBlocks(have, toml)
+	for _, block := range parseKeyBlocks(want, toml) {
+		if block.key == "" {
+			continue
+		}
+
+		replaced := false
+		last := -1
+		for i, existing := range result {
+			if existing.section != block.section {
+				continue
+			}
+			if existing.key == block.key {
+				result[i].lines = block.lines
+				replaced = true
+				break
+			}
+			if existing.header || existing.key != "" {
+				last = i
+			}
+		}
+		if replaced {
+			continue
+		}
+
+		switch {
+		case last >= 0:
+			result = append(result[:last+1], append([]keyBlock{block}, result[last+1:]...)...)
+		case block.section == "":
+			// Top-level keys go before the first section
+			result = append([]keyBlock{block}, result...)
+		default:
+			if len(result) > 0 && strings.TrimSpace(result[len(result)-1].lines[0]) != "" {
+				result = append(result, keyBlock{section: block.section, lines: []string{""}})
+			}
+			result = append(result, keyBlock{section: block.section, header: true, lines: []string{"[" + block.section + "]"}}, block)
+		}
+	}
+
+	var out strings.Builder
+	for _, block := range result {
+		for _, line := range block.lines {
+			out.WriteString(line)
+			out.WriteByte('\n')
+		}
+	}
+	return []byte(out.String())
+}
@@ -0,0 +1,723 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// monitorMode is a resolution and refresh rate an output supports. A zero
+// Refresh lets Hyprland pick the rate, for modes read from DRM.
+type monitorMode struct {
+	Width   int
+	Height  int
+	Refresh float64
+}
+
+func (m monitorMode) resolution() string {
+	return fmt.Sprintf("%dx%d", m.Width, m.Height)
+}
+
+// String formats the mode as in a Hyprland monitor line.
+func (m monitorMode) String() string {
+	if m.Refresh == 0 {
+		return m.resolution()
+	}
+	return fmt.Sprintf("%s@%.2f", m.resolution(), m.Refresh)
+}
+
+var monitorModePattern = regexp.MustCompile(`^(\d+)x(\d+)(?:@([\d.]+)(?:Hz)?)?$`)
+
+// parseMonitorMode reads a mode as hyprctl lists it, 1920x1080@60.00Hz, or
+// as DRM does, 1920x1080.
+func parseMonitorMode(s string) (monitorMode, bool) {
+	match := monitorModePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return monitorMode{}, false
+	}
+	mode := monitorMode{}
+	mode.Width, _ = strconv.Atoi(match[1])
+	mode.Height, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		mode.Refresh, _ = strconv.ParseFloat(match[3], 64)
+	}
+	return mode, true
+}
+
+// monitorOutput is a connected display and how it is arranged.
+type monitorOutput struct {
+	Name        string
+	Description string
+	// Modes are in the order the source lists them, the preferred first
+	Modes    []monitorMode
+	Mode     int
+	Scale    float64
+	Disabled bool
+	// X and Y are the position Hyprland reported, used for the initial
+	// order, or the one typed in when Placed is set
+	X, Y   int
+	Placed bool
+}
+
+// hyprMonitor is an element of `hyprctl monitors all -j`.
+type hyprMonitor struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	Width          int      `json:"width"`
+	Height         int      `json:"height"`
+	RefreshRate    float64  `json:"refreshRate"`
+	X              int      `json:"x"`
+	Y              int      `json:"y"`
+	Scale          float64  `json:"scale"`
+	Disabled       bool     `json:"disabled"`
+	AvailableModes []string `json:"availableModes"`
+}
+
+// parseHyprMonitors reads the output of `hyprctl monitors all -j`.
+func parseHyprMonitors(data []byte) ([]monitorOutput, error) {
+	var monitors []hyprMonitor
+	if err := json.Unmarshal(data, &monitors); err != nil {
+		return nil, fmt.Errorf("parsing hyprctl monitors: %w", err)
+	}
+
+	var outputs []monitorOutput
+	for _, monitor := range monitors {
+		output := monitorOutput{
+			Name:        monitor.Name,
+			Description: monitor.Description,
+			Scale:       nearestScale(monitor.Scale),
+			Disabled:    monitor.Disabled,
+			X:           monitor.X,
+			Y:           monitor.Y,
+		}
+		for _, s := range monitor.AvailableModes {
+			if mode, ok := parseMonitorMode(s); ok {
+				output.Modes = append(output.Modes, mode)
+			}
+		}
+		current := monitorMode{Width: monitor.Width, Height: monitor.Height, Refresh: monitor.RefreshRate}
+		output.Mode = closestMode(output.Modes, current)
+		if output.Mode < 0 {
+			output.Modes = append([]monitorMode{current}, output.Modes...)
+			output.Mode = 0
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// closestMode returns the index of the mode with the resolution of want and
+// the nearest refresh rate, or -1.
+func closestMode(modes []monitorMode, want monitorMode) int {
+	best := -1
+	for i, mode := range modes {
+		if mode.Width != want.Width || mode.Height != want.Height {
+			continue
+		}
+		if best < 0 || abs(mode.Refresh-want.Refresh) < abs(modes[best].Refresh-want.Refresh) {
+			best = i
+		}
+	}
+	return best
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+var drmConnector = regexp.MustCompile(`^card\d+-(.+)$`)
+
+// readDRMOutputs reads the connected outputs from a /sys/class/drm tree.
+// Connector names such as card1-HDMI-A-1 are what Hyprland calls HDMI-A-1.
+func readDRMOutputs(fsys fs.FS) ([]monitorOutput, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []monitorOutput
+	for _, entry := range entries {
+		match := drmConnector.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		status, err := fs.ReadFile(fsys, entry.Name()+"/status")
+		if err != nil || strings.TrimSpace(string(status)) != "connected" {
+			continue
+		}
+		modes, err := fs.ReadFile(fsys, entry.Name()+"/modes")
+		if err != nil {
+			return nil, err
+		}
+
+		output := monitorOutput{Name: match[1], Scale: 1}
+		seen := make(map[monitorMode]bool)
+		scanner := bufio.NewScanner(bytes.NewReader(modes))
+		for scanner.Scan() {
+			// Interlaced modes end in i and aren't offered
+			mode, ok := parseMonitorMode(scanner.Text())
+			if ok && !seen[mode] {
+				seen[mode] = true
+				output.Modes = append(output.Modes, mode)
+			}
+		}
+		if len(output.Modes) == 0 {
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// detectMonitors asks Hyprland for the outputs when it runs, and reads DRM
+// otherwise.
+func detectMonitors() ([]monitorOutput, string, error) {
+	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "" {
+		if out, err := exec.Command("hyprctl", "monitors", "all", "-j").Output(); err == nil {
+			outputs, err := parseHyprMonitors(out)
+			return outputs, "hyprctl", err
+		}
+	}
+	outputs, err := readDRMOutputs(os.DirFS("/sys/class/drm"))
+	return outputs, "/sys/class/drm", err
+}
+
+// monitorScales are the scales offered, the ones that divide the common
+// resolutions into whole logical pixels.
+var monitorScales = []float64{1, 1.25, 1.333333, 1.5, 1.6, 1.666667, 2, 2.5, 3}
+
+func nearestScale(scale float64) float64 {
+	best := monitorScales[0]
+	for _, s := range monitorScales {
+		if abs(s-scale) < abs(best-scale) {
+			best = s
+		}
+	}
+	return best
+}
+
+// monitorLayout places the enabled outputs next to each other, in a row or
+// stacked, and assigns the workspaces to them.
+type monitorLayout struct {
+	Outputs  []monitorOutput
+	Vertical bool
+}
+
+// positions returns the position of every output in logical pixels. The
+// outputs placed by hand stay where they were put, and the others follow
+// the outputs before them in order.
+func (l monitorLayout) positions() [][2]int {
+	positions := make([][2]int, len(l.Outputs))
+	offset := 0
+	for i, output := range l.Outputs {
+		if output.Disabled {
+			continue
+		}
+		mode := output.Modes[output.Mode]
+		width, height := int(float64(mode.Width)/output.Scale), int(float64(mode.Height)/output.Scale)
+		switch {
+		case output.Placed && l.Vertical:
+			positions[i] = [2]int{output.X, output.Y}
+			offset = max(offset, output.Y+height)
+		case output.Placed:
+			positions[i] = [2]int{output.X, output.Y}
+			offset = max(offset, output.X+width)
+		case l.Vertical:
+			positions[i] = [2]int{0, offset}
+			offset += height
+		default:
+			positions[i] = [2]int{offset, 0}
+			offset += width
+		}
+	}
+	return positions
+}
+
+var monitorPosition = regexp.MustCompile(`^(-?\d+)x(-?\d+)$`)
+
+// place puts the output at a position typed as XxY, or back in the order
+// with auto or nothing.
+func (o *monitorOutput) place(position string) error {
+	if position == "" || position == "auto" {
+		o.Placed = false
+		return nil
+	}
+	match := monitorPosition.FindStringSubmatch(position)
+	if match == nil {
+		return fmt.Errorf("a position is XxY in logical pixels, such as 1920x0, or auto")
+	}
+	o.X, _ = strconv.Atoi(match[1])
+	o.Y, _ = strconv.Atoi(match[2])
+	o.Placed = true
+	return nil
+}
+
+// workspaces splits workspaces 1 to 10 between the enabled outputs, in
+// order. It returns the output index of every workspace.
+func (l monitorLayout) workspaces() []int {
+	var enabled []int
+	for i, output := range l.Outputs {
+		if !output.Disabled {
+			enabled = append(enabled, i)
+		}
+	}
+	if len(enabled) == 0 {
+		return nil
+	}
+	assigned := make([]int, 10)
+	for w := range assigned {
+		assigned[w] = enabled[w*len(enabled)/len(assigned)]
+	}
+	return assigned
+}
+
+// preset renders the layout as a preset of hypr/conf/monitors.
+func (l monitorLayout) preset(name string) []byte {
+	var out strings.Builder
+	out.WriteString("# -----------------------------------------------------\n")
+	out.WriteString("# Monitor Setup\n")
+	fmt.Fprintf(&out, "# name: %q\n", name)
+	out.WriteString("# Generated by dotfiles-installer from the connected displays\n")
+	out.WriteString("# -----------------------------------------------------\n\n")
+
+	positions := l.positions()
+	for i, output := range l.Outputs {
+		if output.Disabled {
+			fmt.Fprintf(&out, "monitor=%s,disable\n", output.Name)
+			continue
+		}
+		fmt.Fprintf(&out, "monitor=%s,%s,%dx%d,%s\n", output.Name, output.Modes[output.Mode],
+			positions[i][0], positions[i][1], strconv.FormatFloat(output.Scale, 'f', -1, 64))
+	}
+	// Displays plugged in later
+	out.WriteString("monitor=,preferred,auto,1\n")
+
+	previous := -1
+	for w, i := range l.workspaces() {
+		if i != previous {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "workspace=%d,monitor:%s", w+1, l.Outputs[i].Name)
+		if i != previous {
+			out.WriteString(",default:true")
+		}
+		out.WriteString("\n")
+		previous = i
+	}
+	return []byte(out.String())
+}
+
+// resolutions lists the distinct resolutions of an output in order.
+func (o monitorOutput) resolutions() []string {
+	var resolutions []string
+	for _, mode := range o.Modes {
+		if !slices.Contains(resolutions, mode.resolution()) {
+			resolutions = append(resolutions, mode.resolution())
+		}
+	}
+	return resolutions
+}
+
+// cycleResolution moves to the next or previous resolution, at its first
+// listed refresh rate.
+func (o *monitorOutput) cycleResolution(step int) {
+	resolutions := o.resolutions()
+	i := slices.Index(resolutions, o.Modes[o.Mode].resolution())
+	next := resolutions[(i+step+len(resolutions))%len(resolutions)]
+	for j, mode := range o.Modes {
+		if mode.resolution() == next {
+			o.Mode = j
+			return
+		}
+	}
+}
+
+// cycleRefresh moves to the next refresh rate of the current resolution.
+func (o *monitorOutput) cycleRefresh() {
+	resolution := o.Modes[o.Mode].resolution()
+	for step := 1; step < len(o.Modes); step++ {
+		j := (o.Mode + step) % len(o.Modes)
+		if o.Modes[j].resolution() == resolution {
+			o.Mode = j
+			return
+		}
+	}
+}
+
+func (o *monitorOutput) cycleScale(step int) {
+	i := 0
+	for j, s := range monitorScales {
+		if s == o.Scale {
+			i = j
+		}
+	}
+	o.Scale = monitorScales[max(min(i+step, len(monitorScales)-1), 0)]
+}
+
+var presetName = regexp.MustCompile(`^[A-Za-z0-9@._-]+$`)
+
+// detectedMonitors is the preset the dotfiles review arranges the displays
+// in.
+const detectedMonitors = "detected"
+
+// monitorsForm arranges the detected outputs and writes them as a preset.
+type monitorsForm struct {
+	source  string
+	home    string
+	profile profile
+	layout  monitorLayout
+	from    string
+	// inProfile keeps the preset in the profile, which deploys it with the
+	// dotfiles, instead of writing it to the checkout
+	inProfile bool
+	cursor    int
+	// naming is set while the name of the preset is typed in, placing
+	// while the position of the selected output is
+	naming  bool
+	placing bool
+	input   string
+	message string
+	err     error
+}
+
+func newMonitorsForm(source, home string, prof profile, outputs []monitorOutput, from string, inProfile bool) monitorsForm {
+	// Keep the arrangement Hyprland reported, left to right and top down
+	sort.SliceStable(outputs, func(i, j int) bool {
+		if outputs[i].X != outputs[j].X {
+			return outputs[i].X < outputs[j].X
+		}
+		return outputs[i].Y < outputs[j].Y
+	})
+	return monitorsForm{source: source, home: home, profile: prof, layout: monitorLayout{Outputs: outputs}, from: from, inProfile: inProfile}
+}
+
+// update handles a key and reports whether the form is done.
+func (m monitorsForm) update(key tea.KeyMsg) (monitorsForm, bool, tea.Cmd) {
+	outputs := m.layout.Outputs
+	if len(outputs) == 0 {
+		return m, true, nil
+	}
+
+	if m.naming || m.placing {
+		switch key.Type {
+		case tea.KeyCtrlC:
+			return m, true, tea.Quit
+		case tea.KeyEsc:
+			m.naming, m.placing, m.err = false, false, nil
+		case tea.KeyEnter:
+			if m.placing {
+				m.err = outputs[m.cursor].place(strings.TrimSpace(m.input))
+				m.placing = m.err != nil
+				break
+			}
+			m.message, m.err = m.write(strings.TrimSpace(m.input))
+			m.naming = m.err != nil
+		case tea.KeyBackspace:
+			if runes := []rune(m.input); len(runes) > 0 {
+				m.input = string(runes[:len(runes)-1])
+			}
+		case tea.KeyRunes:
+			m.input += string(key.Runes)
+		}
+		return m, false, nil
+	}
+
+	output := &outputs[m.cursor]
+	switch key.String() {
+	case "ctrl+c":
+		return m, true, tea.Quit
+	case "q", "esc":
+		return m, true, nil
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, len(outputs)-1)
+	case "left", "h":
+		output.cycleResolution(-1)
+	case "right", "l":
+		output.cycleResolution(1)
+	case "r":
+		output.cycleRefresh()
+	case "+", "=":
+		output.cycleScale(1)
+	case "-":
+		output.cycleScale(-1)
+	case " ", "space":
+		output.Disabled = !output.Disabled
+	case "[":
+		// Move the output before the previous one
+		if m.cursor > 0 {
+			outputs[m.cursor-1], outputs[m.cursor] = outputs[m.cursor], outputs[m.cursor-1]
+			m.cursor--
+		}
+	case "]":
+		if m.cursor < len(outputs)-1 {
+			outputs[m.cursor+1], outputs[m.cursor] = outputs[m.cursor], outputs[m.cursor+1]
+			m.cursor++
+		}
+	case "v":
+		m.layout.Vertical = !m.layout.Vertical
+	case "p":
+		if !output.Disabled {
+			position := m.layout.positions()[m.cursor]
+			m.placing, m.input, m.err = true, fmt.Sprintf("%dx%d", position[0], position[1]), nil
+		}
+	case "enter", "w":
+		if m.inProfile {
+			m.message, m.err = m.keep()
+			break
+		}
+		m.naming, m.input, m.err = true, detectedMonitors, nil
+	}
+	return m, false, nil
+}
+
+// keep saves the layout to the profile as the detected preset and selects
+// it. Neither the checkout nor $HOME is changed.
+func (m *monitorsForm) keep() (string, error) {
+	if m.layout.workspaces() == nil {
+		return "", fmt.Errorf("at least one display has to stay enabled")
+	}
+	prof, err := loadProfile()
+	if err != nil {
+		return "", err
+	}
+	prof.Monitor, prof.Displays = detectedMonitors, string(m.layout.preset(detectedMonitors))
+	if err := prof.save(); err != nil {
+		return "", err
+	}
+	m.profile = prof
+	return fmt.Sprintf("Saved to the profile, %s/monitors/%s.conf is written with the dotfiles", hyprConfDir, detectedMonitors), nil
+}
+
+// write saves the layout as a preset in the checkout, selects it in the
+// profile and, if the Hyprland config is deployed, puts both in place.
+func (m *monitorsForm) write(name string) (string, error) {
+	if !presetName.MatchString(name) {
+		return "", fmt.Errorf("a preset name can only use letters, digits, @, ., _ and -")
+	}
+	if m.layout.workspaces() == nil {
+		return "", fmt.Errorf("at least one display has to stay enabled")
+	}
+	preset := m.layout.preset(name)
+	rel := filepath.Join(hyprConfDir, "monitors", name+".conf")
+	if err := writeFileAtomic(filepath.Join(m.source, rel), preset, 0644); err != nil {
+		return "", err
+	}
+
+	prof := m.profile
+	prof.Monitor = name
+	if err := prof.validate(m.source); err != nil {
+		return "", err
+	}
+	if err := prof.save(); err != nil {
+		return "", err
+	}
+	m.profile = prof
+
+	if _, err := os.Stat(filepath.Join(m.home, hyprConfDir)); err != nil {
+		return fmt.Sprintf("✅ Wrote %s to the dotfiles, it is used when they are deployed", rel), nil
+	}
+	if err := writeFileAtomic(filepath.Join(m.home, rel), preset, 0644); err != nil {
+		return "", err
+	}
+	if _, err := writeRendered(m.source, m.home, prof, hyprConfDir+"/monitor.conf"); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("✅ Wrote %s to the dotfiles and ~/%s", rel, rel), nil
+}
+
+func (m monitorsForm) view() string {
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("🖥️  Monitor Setup"))
+	result.WriteString("\n")
+
+	outputs := m.layout.Outputs
+	if len(outputs) == 0 {
+		result.WriteString(fmt.Sprintf("No connected displays found in %s.\n\nPress any key to go back...", m.from))
+		return result.String()
+	}
+	detected := fmt.Sprintf("%d display(s) detected with %s", len(outputs), m.from)
+	if m.inProfile {
+		detected += fmt.Sprintf(", arranged as the %s preset in the machine profile", detectedMonitors)
+	}
+	result.WriteString(descriptionStyle.Render(detected))
+	result.WriteString("\n\n")
+
+	positions := m.layout.positions()
+	workspaces := m.layout.workspaces()
+	for i, output := range outputs {
+		line := fmt.Sprintf("%-10s disabled", output.Name)
+		if !output.Disabled {
+			var assigned []string
+			for w, o := range workspaces {
+				if o == i {
+					assigned = append(assigned, strconv.Itoa(w+1))
+				}
+			}
+			position := fmt.Sprintf("%dx%d", positions[i][0], positions[i][1])
+			if output.Placed {
+				position += " (typed)"
+			}
+			line = fmt.Sprintf("%-10s %-18s scale %-9s at %-18s workspaces %s", output.Name, output.Modes[output.Mode],
+				strconv.FormatFloat(output.Scale, 'f', -1, 64), position, strings.Join(assigned, ","))
+		}
+		if i == m.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else {
+			result.WriteString(unselectedStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+		if output.Description != "" {
+			result.WriteString(descriptionStyle.Render("    " + output.Description))
+			result.WriteString("\n")
+		}
+	}
+
+	if m.naming {
+		result.WriteString("\n")
+		result.WriteString(selectedStyle.Render("Preset name: " + m.input + "█"))
+		result.WriteString("\n")
+	} else if m.placing {
+		result.WriteString("\n")
+		result.WriteString(selectedStyle.Render("Position of " + outputs[m.cursor].Name + ": " + m.input + "█"))
+		result.WriteString("\n")
+	}
+	if m.err != nil {
+		result.WriteString("\n")
+		result.WriteString(errorStyle.Render(m.err.Error()))
+		result.WriteString("\n")
+	} else if m.message != "" {
+		result.WriteString("\n")
+		result.WriteString(successStyle.Render(m.message))
+		result.WriteString("\n")
+	}
+
+	if m.naming {
+		result.WriteString("\nType the name of the preset, ENTER to write it, ESC to cancel")
+		return result.String()
+	}
+	if m.placing {
+		result.WriteString("\nType the position as XxY in logical pixels, or auto to follow the order, ENTER to keep it, ESC to cancel")
+		return result.String()
+	}
+	layout := "side by side"
+	if m.layout.Vertical {
+		layout = "stacked"
+	}
+	result.WriteString(fmt.Sprintf("\nDisplays are %s, in this order. Use ↑↓ to select a display, [ ] to move it, v to stack or line them up\n", layout))
+	result.WriteString("←→ resolution, r refresh rate, +/- scale, p to type its position, SPACE to disable, ENTER to write the preset, ESC to go back")
+	return result.String()
+}
+
+// updateMonitorsForm handles keys on the monitor screen of the dotfiles
+// review, which rescans the dotfiles with the preset saved to the profile.
+func (m model) updateMonitorsForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	form, done, cmd := m.monitors.update(msg)
+	m.monitors = form
+	if done && cmd == nil {
+		m.editingMonitors = false
+		m.review.profile.Monitor = form.profile.Monitor
+		m.review.profile.Displays = form.profile.Displays
+		m.review = m.review.rescan(m.review.mode)
+	}
+	return m, cmd
+}
+
+// monitorsModel is the monitor form on its own.
+type monitorsModel struct {
+	form monitorsForm
+}
+
+func (m monitorsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m monitorsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		form, done, _ := m.form.update(key)
+		m.form = form
+		if done {
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m monitorsModel) View() string {
+	return m.form.view()
+}
+
+// monitorsCommand implements `dotfiles-installer monitors`. The outputs can
+// be read from a saved `hyprctl monitors all -j` or a copy of
+// /sys/class/drm instead of the running system.
+func monitorsCommand(args []string) error {
+	flags := flag.NewFlagSet("monitors", flag.ContinueOnError)
+	hyprctl := flags.String("hyprctl", "", "read the outputs from a saved hyprctl monitors all -j")
+	sysfs := flags.String("drm", "", "read the outputs from a copy of /sys/class/drm")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("usage: dotfiles-installer monitors [--hyprctl file | --drm dir]")
+	}
+
+	source, err := filepath.Abs(dotfilesSourceDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	prof, err := loadProfile()
+	if err != nil {
+		return err
+	}
+
+	var outputs []monitorOutput
+	from := *hyprctl
+	switch {
+	case *hyprctl != "":
+		data, err := os.ReadFile(*hyprctl)
+		if err != nil {
+			return err
+		}
+		outputs, err = parseHyprMonitors(data)
+		if err != nil {
+			return err
+		}
+	case *sysfs != "":
+		from = *sysfs
+		if outputs, err = readDRMOutputs(os.DirFS(*sysfs)); err != nil {
+			return err
+		}
+	default:
+		if outputs, from, err = detectMonitors(); err != nil {
+			return err
+		}
+	}
+
+	p := tea.NewProgram(monitorsModel{form: newMonitorsForm(source, home, prof, outputs, from, false)}, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
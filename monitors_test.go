@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseHyprMonitors(t *testing.T) {
+	data, err := os.ReadFile("testdata/monitors/hyprctl.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := parseHyprMonitors(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		preferred monitorMode
+		mode      monitorMode
+		modes     int
+		scale     float64
+		disabled  bool
+		x         int
+	}{
+		// The current mode is the preferred one, the scale is snapped
+		{name: "eDP-1", preferred: monitorMode{2880, 1800, 90}, mode: monitorMode{2880, 1800, 90}, modes: 4, scale: 1.666667},
+		// 143.97Hz is closest to the listed 143.91Hz, not the first 2560x1440 mode
+		{name: "DP-2", preferred: monitorMode{2560, 1440, 59.95}, mode: monitorMode{2560, 1440, 143.91}, modes: 5, scale: 1, x: -2560},
+		// A current mode missing from the list is added in front of it
+		{name: "HDMI-A-1", preferred: monitorMode{3840, 2160, 30}, mode: monitorMode{3840, 2160, 30}, modes: 4, scale: 2, disabled: true},
+	}
+	if len(outputs) != len(tests) {
+		t.Fatalf("got %d outputs, want %d", len(outputs), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := outputs[i]
+			if output.Name != tt.name {
+				t.Fatalf("name = %q, want %q", output.Name, tt.name)
+			}
+			if output.Modes[0] != tt.preferred {
+				t.Errorf("first mode = %v, want %v", output.Modes[0], tt.preferred)
+			}
+			if got := output.Modes[output.Mode]; got != tt.mode {
+				t.Errorf("mode = %v, want %v", got, tt.mode)
+			}
+			if len(output.Modes) != tt.modes {
+				t.Errorf("got %d modes, want %d", len(output.Modes), tt.modes)
+			}
+			if output.Scale != tt.scale {
+				t.Errorf("scale = %v, want %v", output.Scale, tt.scale)
+			}
+			if output.Disabled != tt.disabled {
+				t.Errorf("disabled = %v, want %v", output.Disabled, tt.disabled)
+			}
+			if output.X != tt.x {
+				t.Errorf("x = %d, want %d", output.X, tt.x)
+			}
+		})
+	}
+}
+
+func TestClosestMode(t *testing.T) {
+	modes := []monitorMode{{2560, 1440, 59.95}, {2560, 1440, 165.08}, {2560, 1440, 143.91}, {1920, 1080, 60}}
+	tests := []struct {
+		name string
+		want monitorMode
+		mode int
+	}{
+		{name: "exact", want: monitorMode{2560, 1440, 165.08}, mode: 1},
+		{name: "nearest refresh", want: monitorMode{2560, 1440, 143.97301}, mode: 2},
+		{name: "lower refresh", want: monitorMode{2560, 1440, 50}, mode: 0},
+		{name: "other resolution", want: monitorMode{1920, 1080, 75}, mode: 3},
+		{name: "no such resolution", want: monitorMode{3840, 2160, 60}, mode: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := closestMode(modes, tt.want); got != tt.mode {
+				t.Errorf("closestMode(%v) = %d, want %d", tt.want, got, tt.mode)
+			}
+		})
+	}
+}
+
+func TestReadDRMOutputs(t *testing.T) {
+	outputs, err := readDRMOutputs(os.DirFS("testdata/monitors/drm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// card1-DP-1 is disconnected and card1-Writeback-1 unknown. Duplicate
+	// and interlaced modes are left out, the preferred mode stays first.
+	want := []monitorOutput{
+		{Name: "HDMI-A-1", Scale: 1, Modes: []monitorMode{{2560, 1440, 0}, {1920, 1080, 0}, {1280, 720, 0}}},
+		{Name: "eDP-1", Scale: 1, Modes: []monitorMode{{2880, 1800, 0}, {1920, 1200, 0}, {1680, 1050, 0}, {1280, 800, 0}}},
+	}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("readDRMOutputs() = %+v, want %+v", outputs, want)
+	}
+}
+
+func TestNearestScale(t *testing.T) {
+	tests := []struct {
+		scale float64
+		want  float64
+	}{
+		{1, 1},
+		{1.2, 1.25},
+		{1.33, 1.333333},
+		{1.8, 1.666667},
+		{1.9, 2},
+		{0.5, 1},
+		{4, 3},
+	}
+	for _, tt := range tests {
+		if got := nearestScale(tt.scale); got != tt.want {
+			t.Errorf("nearestScale(%v) = %v, want %v", tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	laptop := monitorOutput{Name: "eDP-1", Modes: []monitorMode{{2880, 1800, 90}}, Scale: 2}
+	desk := monitorOutput{Name: "DP-2", Modes: []monitorMode{{2560, 1440, 144}}, Scale: 1}
+	placed := desk
+	placed.X, placed.Y, placed.Placed = 0, -1440, true
+	off := desk
+	off.Disabled = true
+
+	tests := []struct {
+		name   string
+		layout monitorLayout
+		want   [][2]int
+	}{
+		{name: "side by side", layout: monitorLayout{Outputs: []monitorOutput{laptop, desk}}, want: [][2]int{{0, 0}, {1440, 0}}},
+		{name: "stacked", layout: monitorLayout{Outputs: []monitorOutput{desk, laptop}, Vertical: true}, want: [][2]int{{0, 0}, {0, 1440}}},
+		// The laptop follows the right edge of the display typed in
+		{name: "typed", layout: monitorLayout{Outputs: []monitorOutput{placed, laptop}}, want: [][2]int{{0, -1440}, {2560, 0}}},
+		{name: "disabled", layout: monitorLayout{Outputs: []monitorOutput{off, laptop}}, want: [][2]int{{0, 0}, {0, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.layout.positions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("positions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// packageSet lists the packages a step installs from the official
+// repositories and from the AUR.
+type packageSet struct {
+	Repo []string
+	AUR  []string
+}
+
+// stepPackages mirrors the package arrays of the lib/*.sh step functions.
+// Steps that pick their packages at run time (configure_nvidia prompts for a
+// driver, install_virtualbox_guest checks the VM type, install_mongodb falls
+// back between AUR packages) are left out and keep installing their own.
+var stepPackages = map[string]packageSet{
+	"install_packages": {Repo: []string{
+		"pacman-contrib", "git", "base-devel", "wget", "curl", "gcc", "sed", "go",
+		"networkmanager", "pipewire", "pipewire-pulse", "wireplumber", "linux-headers",
+		"xorg", "egl-wayland", "xorg-xwayland", "gvfs", "libnotify", "polkit-gnome",
+		"fuse2", "python-pip", "python-gobject",
+	}},
+	"install_aur_helper": {Repo: []string{"base-devel", "rust"}},
+	"configure_amd": {Repo: []string{
+		"mesa", "lib32-mesa", "xf86-video-amdgpu", "vulkan-radeon", "lib32-vulkan-radeon",
+		"libva-mesa-driver", "lib32-libva-mesa-driver", "mesa-vdpau", "lib32-mesa-vdpau", "amd-ucode",
+	}},
+	"configure_intel": {Repo: []string{
+		"mesa", "lib32-mesa", "intel-media-driver", "vulkan-intel", "lib32-vulkan-intel",
+		"libva-intel-driver", "intel-gpu-tools", "intel-ucode",
+	}},
+	"install_vscode":      {AUR: []string{"visual-studio-code-bin"}},
+	"install_neovim":      {Repo: []string{"neovim"}},
+	"install_git":         {Repo: []string{"git"}},
+	"install_docker":      {Repo: []string{"docker", "docker-compose", "docker-buildx"}},
+	"install_zen":         {AUR: []string{"zen-browser-bin"}},
+	"install_firefox":     {Repo: []string{"firefox"}},
+	"install_chromium":    {Repo: []string{"chromium"}},
+	"install_vesktop":     {AUR: []string{"vesktop-bin"}},
+	"install_telegram":    {Repo: []string{"telegram-desktop"}},
+	"install_signal":      {AUR: []string{"signal-desktop"}},
+	"install_spotube":     {AUR: []string{"spotube-bin"}},
+	"install_vlc":         {Repo: []string{"vlc"}},
+	"install_gimp":        {Repo: []string{"gimp"}},
+	"install_pinta":       {AUR: []string{"pinta"}},
+	"install_obs":         {Repo: []string{"obs-studio"}},
+	"install_libreoffice": {Repo: []string{"libreoffice-fresh"}},
+	"install_thunderbird": {Repo: []string{"thunderbird"}},
+	"install_steam":       {Repo: []string{"steam"}},
+	"install_qemu_kvm": {Repo: []string{
+		"qemu-desktop", "libvirt", "virt-manager", "virt-viewer", "dnsmasq", "vde2",
+		"bridge-utils", "openbsd-netcat", "ebtables", "iptables", "dmidecode",
+	}},
+	"install_wine":              {Repo: []string{"wine", "winetricks", "wine-gecko", "wine-mono"}},
+	"install_terminal_emulator": {Repo: []string{"kitty"}},
+	"install_system_monitor":    {Repo: []string{"btop"}},
+	"install_bat":               {Repo: []string{"bat"}},
+	"install_tldr":              {Repo: []string{"tldr"}},
+	"install_onefetch":          {Repo: []string{"onefetch"}},
+	"install_nautilus":          {Repo: []string{"nautilus"}},
+	"install_superfile":         {Repo: []string{"superfile"}},
+	"install_calculator":        {Repo: []string{"gnome-calculator"}},
+	"install_discover":          {Repo: []string{"discover"}},
+	"install_blueman":           {Repo: []string{"blueman"}},
+	"install_cmatrix":           {Repo: []string{"cmatrix"}},
+	"install_cbonsai":           {AUR: []string{"cbonsai"}},
+	"install_pipes_rs":          {AUR: []string{"pipes-rs"}},
+	"install_astroterm":         {Repo: []string{"astroterm"}},
+	"install_theming":           {Repo: []string{"papirus-icon-theme", "breeze", "libadwaita", "python-pywal"}},
+	"install_hyprland_wm": {Repo: []string{
+		"hyprland", "hyprpaper", "hyprlock", "hypridle", "hyprpicker", "waybar", "rofi-wayland",
+		"swaync", "slurp", "grim", "cliphist", "xclip", "qt5-wayland", "qt6-wayland",
+	}},
+	"install_desktop_portals":     {Repo: []string{"xdg-desktop-portal-gtk", "xdg-desktop-portal-hyprland"}},
+	"install_display_manager":     {Repo: []string{"sddm", "qt5-graphicaleffects", "qt5-quickcontrols2", "qt5-svg", "qt6ct"}},
+	"install_security_tools":      {Repo: []string{"gnome-keyring", "libsecret", "seahorse"}},
+	"install_terminal_tools":      {Repo: []string{"zsh", "zsh-completions", "eza", "fzf", "fd", "atuin", "zoxide", "jq"}},
+	"install_network_tools":       {Repo: []string{"nm-connection-editor", "network-manager-applet", "gping", "dog"}},
+	"install_file_manager":        {Repo: []string{"nwg-dock-hyprland", "nwg-look"}},
+	"install_multimedia_base":     {Repo: []string{"pavucontrol", "brightnessctl", "imagemagick"}},
+	"install_bluetooth":           {Repo: []string{"bluez-utils"}},
+	"install_software_management": {Repo: []string{"flatpak"}},
+	"install_fonts": {Repo: []string{
+		"ttf-fira-code", "ttf-fira-sans", "ttf-dejavu", "otf-font-awesome", "ttf-firacode-nerd",
+		"noto-fonts", "noto-fonts-emoji", "noto-fonts-cjk", "noto-fonts-extra",
+	}},
+	"setup_zsh": {Repo: []string{"zsh"}},
+}
+
+// aurHelperStep is the step that has to run before any AUR package can be
+// installed.
+const aurHelperStep = "install_aur_helper"
+
+// installPlan is the result of the planning phase: the deduplicated package
+// transactions and the steps whose configuration logic runs afterwards.
+type installPlan struct {
+	Steps        []InstallStep
+	RepoPackages []string
+	AURPackages  []string
+	// Environment is the Hyprland environment variant the plan selects
+	Environment environmentProposal
+	// Hypr are the problems of the Hyprland config in $HOME, checked when
+	// the Dotfiles step, whose review checks it otherwise, isn't planned
+	Hypr []hyprIssue
+}
+
+// selectedStepList returns the steps that will run, in category order.
+func (m model) selectedStepList() []InstallStep {
+	var steps []InstallStep
+	for _, category := range m.categories {
+		for _, step := range category.Steps {
+			// Dotfiles sub-items only shape what the Dotfiles step deploys
+			if step.Config != "" {
+				continue
+			}
+			if step.Required || m.selectedSteps[step.Function] {
+				steps = append(steps, step)
+			}
+		}
+	}
+	return steps
+}
+
+// planInstallation collects and deduplicates the packages of all steps,
+// keeping the order in which they are first requested.
+func planInstallation(steps []InstallStep) installPlan {
+	plan := installPlan{Steps: steps}
+	seen := make(map[string]bool)
+
+	for _, step := range steps {
+		packages := stepPackages[step.Function]
+		for _, pkg := range packages.Repo {
+			if !seen[pkg] {
+				seen[pkg] = true
+				plan.RepoPackages = append(plan.RepoPackages, pkg)
+			}
+		}
+		for _, pkg := range packages.AUR {
+			if !seen[pkg] {
+				seen[pkg] = true
+				plan.AURPackages = append(plan.AURPackages, pkg)
+			}
+		}
+	}
+	return plan
+}
+
+// Units the step runner executes besides the selected steps.
+const (
+	preflightUnit    = "init_utils"
+	repoPackagesUnit = "install_repo_packages"
+	aurPackagesUnit  = "install_aur_packages"
+)
+
+// nativeSteps are implemented in Go rather than by the shell libraries.
+var nativeSteps = map[string]func(model, *runState, func(string)) unitResult{
+	dotfilesStep: model.runDotfilesStep,
+}
+
+// checkHypr checks the Hyprland config left in home against the planned
+// packages, unless the Dotfiles step replaces it and its review checks it.
+func (p installPlan) checkHypr(home string) []hyprIssue {
+	if p.hasStep(dotfilesStep) {
+		return nil
+	}
+	return checkHyprConfig(homeReader(home), append(p.RepoPackages, p.AURPackages...))
+}
+
+// hasStep reports whether function is one of the planned steps.
+func (p installPlan) hasStep(function string) bool {
+	for _, step := range p.Steps {
+		if step.Function == function {
+			return true
+		}
+	}
+	return false
+}
+
+// installUnit is a shell function the step runner may be asked to execute.
+type installUnit struct {
+	Function string
+	Name     string
+}
+
+// units lists every unit of the plan in the order they would run without any
+// scheduling. The AUR helper step sits between the repository transaction
+// and the AUR batch since paru is needed for the latter.
+func (p installPlan) units() []installUnit {
+	units := []installUnit{{Function: preflightUnit, Name: "System validation"}}
+	if len(p.RepoPackages) > 0 {
+		units = append(units, installUnit{Function: repoPackagesUnit, Name: "Repository packages"})
+	}
+	for _, step := range p.Steps {
+		if step.Function == aurHelperStep {
+			units = append(units, installUnit{Function: step.Function, Name: step.Name})
+		}
+	}
+	if len(p.AURPackages) > 0 {
+		units = append(units, installUnit{Function: aurPackagesUnit, Name: "AUR packages"})
+	}
+	for _, step := range p.Steps {
+		if step.Function != aurHelperStep {
+			units = append(units, installUnit{Function: step.Function, Name: step.Name})
+		}
+	}
+	return units
+}
+
+// script generates the step runner. It sources the libraries once and then
+// executes the planned units one at a time as the installer requests them on
+// file descriptor 3, reporting each exit code back on stdout.
+func (p installPlan) script() string {
+	var script strings.Builder
+	script.WriteString("#!/bin/bash\n\n")
+	script.WriteString("# The installer reads stdout and writes the run's logs\n")
+	script.WriteString("exec 2>&1\n\n")
+	script.WriteString("FAILED_STEPS=()\n\n")
+
+	// Add source statements for required libraries
+	script.WriteString("# Load utilities and sub-scripts\n")
+	for _, lib := range []string{
+		"utils", "packages", "aur", "nvidia", "apps", "wallpapers", "sddm",
+		"zsh", "fastfetch", "node", "mongodb", "virtualization",
+	} {
+		script.WriteString(fmt.Sprintf("source \"$(pwd)/lib/%s.sh\"\n", lib))
+	}
+	script.WriteString("\n")
+
+	script.WriteString("# Install repository packages of all selected steps in one transaction\n")
+	script.WriteString(fmt.Sprintf("%s() {\n", repoPackagesUnit))
+	script.WriteString(fmt.Sprintf("    install_package_transaction %s\n", strings.Join(p.RepoPackages, " ")))
+	script.WriteString("}\n\n")
+
+	script.WriteString("# Install AUR packages of all selected steps in one paru batch\n")
+	script.WriteString(fmt.Sprintf("%s() {\n", aurPackagesUnit))
+	script.WriteString("    if ! _checkCommandExists paru; then\n")
+	script.WriteString("        echo \"⚠️  Warning: paru is not available, steps will install their own AUR packages\"\n")
+	script.WriteString("        return 1\n")
+	script.WriteString("    fi\n")
+	script.WriteString(fmt.Sprintf("    _installAurPackages %s\n", strings.Join(p.AURPackages, " ")))
+	script.WriteString("}\n\n")
+
+	script.WriteString("# Run a single unit, allowing it to fail, and report its exit code\n")
+	script.WriteString("run_unit() {\n")
+	script.WriteString("    local failed_before=${#FAILED_STEPS[@]}\n")
+	script.WriteString("    echo \"=== Installing: $2 ===\"\n")
+	script.WriteString("    \"$1\"\n")
+	script.WriteString("    local exit_code=$?\n")
+	script.WriteString("    if [ $exit_code -ne 0 ]; then\n")
+	script.WriteString("        echo \"❌ Warning: $2 failed with exit code $exit_code\"\n")
+	script.WriteString("        FAILED_STEPS+=(\"$2\")\n")
+	script.WriteString("    fi\n")
+	script.WriteString("    echo\n")
+	script.WriteString("    local entry\n")
+	script.WriteString("    for entry in \"${FAILED_STEPS[@]:failed_before}\"; do\n")
+	script.WriteString(fmt.Sprintf("        echo \"%s $entry\"\n", unitFailedMarker))
+	script.WriteString("    done\n")
+	script.WriteString(fmt.Sprintf("    echo \"%s $1 $exit_code\"\n", unitDoneMarker))
+	script.WriteString("}\n\n")
+
+	script.WriteString("# Execute the units requested by the installer, restricted to this plan\n")
+	script.WriteString("while read -r -u 3 unit; do\n")
+	script.WriteString("    case \"$unit\" in\n")
+	for _, unit := range p.units() {
+		if _, native := nativeSteps[unit.Function]; native {
+			continue
+		}
+		script.WriteString(fmt.Sprintf("        %s) run_unit %s \"%s\" ;;\n", unit.Function, unit.Function, unit.Name))
+	}
+	script.WriteString("        *)\n")
+	script.WriteString("            echo \"❌ Error: $unit is not part of this installation plan\"\n")
+	script.WriteString(fmt.Sprintf("            echo \"%s $unit 127\"\n", unitDoneMarker))
+	script.WriteString("            ;;\n")
+	script.WriteString("    esac\n")
+	script.WriteString("done\n\n")
+
+	script.WriteString("# Installation complete\n")
+	script.WriteString("echo ''\n")
+	script.WriteString("echo '🎉 ================================'\n")
+	script.WriteString("echo '🎉  SETUP COMPLETE!'\n")
+	script.WriteString("echo '🎉 ================================'\n")
+	script.WriteString("echo ''\n")
+	script.WriteString("report_installation_summary\n\n")
+
+	script.WriteString("# Exit with appropriate code (summary already handled)\n")
+	script.WriteString("if [ ${#FAILED_STEPS[@]} -gt 0 ]; then\n")
+	script.WriteString("    exit 1\n")
+	script.WriteString("else\n")
+	script.WriteString("    exit 0\n")
+	script.WriteString("fi\n")
+	return script.String()
+}
+
+var packageListStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("#A1A1AA")).
+	MarginLeft(3).
+	Width(76)
+
+// planHyprIssues is the number of Hyprland config problems the plan lists.
+const planHyprIssues = 5
+
+// planView renders the installation plan for confirmation.
+func (m model) planView() string {
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("📋 Installation Plan"))
+	result.WriteString("\n\n")
+
+	result.WriteString(categoryStyle.Render(fmt.Sprintf("Repository packages (%d, one pacman transaction)", len(m.plan.RepoPackages))))
+	result.WriteString("\n")
+	if len(m.plan.RepoPackages) > 0 {
+		result.WriteString(packageListStyle.Render(strings.Join(m.plan.RepoPackages, ", ")))
+	} else {
+		result.WriteString(descriptionStyle.Render("None"))
+	}
+	result.WriteString("\n")
+
+	result.WriteString(categoryStyle.Render(fmt.Sprintf("AUR packages (%d, one paru batch)", len(m.plan.AURPackages))))
+	result.WriteString("\n")
+	if len(m.plan.AURPackages) > 0 {
+		result.WriteString(packageListStyle.Render(strings.Join(m.plan.AURPackages, ", ")))
+	} else {
+		result.WriteString(descriptionStyle.Render("None"))
+	}
+	result.WriteString("\n")
+
+	result.WriteString(categoryStyle.Render(fmt.Sprintf("Steps (%d)", len(m.plan.Steps))))
+	result.WriteString("\n")
+	var names []string
+	for _, step := range m.plan.Steps {
+		names = append(names, step.Name)
+	}
+	result.WriteString(packageListStyle.Render(strings.Join(names, " → ")))
+	result.WriteString("\n")
+
+	if env := m.plan.Environment; env.Variant != "" {
+		result.WriteString(categoryStyle.Render("Hyprland environment"))
+		result.WriteString("\n")
+		switch {
+		case env.Variant == env.Current:
+			result.WriteString(packageListStyle.Render(fmt.Sprintf("%s.conf, already selected, since %s", env.Variant, env.Reason)))
+		case env.Keep:
+			result.WriteString(packageListStyle.Render(fmt.Sprintf("%s.conf is kept. %s.conf is proposed since %s. Press e to switch", env.Current, env.Variant, env.Reason)))
+		default:
+			result.WriteString(packageListStyle.Render(fmt.Sprintf("%s.conf instead of %s.conf, since %s. Press e to keep %s.conf", env.Variant, env.Current, env.Reason, env.Current)))
+		}
+		result.WriteString("\n")
+	}
+
+	if errors, warnings := countHyprIssues(m.plan.Hypr); errors+warnings > 0 {
+		result.WriteString(categoryStyle.Render(fmt.Sprintf("Hyprland config (%d error(s), %d warning(s))", errors, warnings)))
+		result.WriteString("\n")
+		for i, issue := range m.plan.Hypr {
+			if i == planHyprIssues {
+				result.WriteString(descriptionStyle.Render(fmt.Sprintf("… %d more, run `dotfiles-installer hypr check` to list them all", len(m.plan.Hypr)-i)))
+				result.WriteString("\n")
+				break
+			}
+			style := errorStyle
+			if issue.Warning {
+				style = warningStyle
+			}
+			result.WriteString(style.Render("  " + issue.String()))
+			result.WriteString("\n")
+		}
+	}
+	result.WriteString("\n")
+
+	result.WriteString("Press ENTER to start installation, ESC to go back, 'q' to quit")
+	return result.String()
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// templateSuffix marks the files of share/dotfiles that are rendered with
+// the profile before they are written. The suffix is dropped in $HOME.
+const templateSuffix = ".tmpl"
+
+// profile holds the per-machine variables the templates are rendered
+// with, as {{ .Terminal }} and so on.
+type profile struct {
+	User string `json:"user"`
+	// Keyboard and Monitor name presets in .config/hypr/conf/keybindings
+	// and .config/hypr/conf/monitors
+	Keyboard string `json:"keyboard"`
+	Monitor  string `json:"monitor"`
+	// KbLayout and KbVariant are the XKB layout set in keyboard.conf
+	KbLayout  string `json:"kb_layout"`
+	KbVariant string `json:"kb_variant"`
+
+	Terminal string `json:"terminal"`
+	Browser  string `json:"browser"`
+	Editor   string `json:"editor"`
+	// Variants maps the other variant groups of .config/hypr/conf, such as
+	// animations, to the name of the chosen file, as {{ .Variant "animations" }}
+	Variants map[string]string `json:"variants"`
+	// Settings maps the files of .config/ml4w/settings to the values that
+	// differ from the checkout's
+	Settings map[string]string `json:"settings,omitempty"`
+	// Waybar lists the modules of each section of the Waybar config as
+	// arranged in the dotfiles review, those commented out as "//name"
+	Waybar map[string][]string `json:"waybar,omitempty"`
+	// Autostart holds the changes made to autostart.conf in the dotfiles
+	// review
+	Autostart *autostartEdits `json:"autostart,omitempty"`
+	// Displays is the monitor preset arranged in the dotfiles review, which
+	// is deployed as monitors/detected.conf
+	Displays string `json:"displays,omitempty"`
+}
+
+// Variant returns the chosen file of a variant group, without .conf.
+func (p profile) Variant(group string) string {
+	switch group {
+	case "monitors":
+		return p.Monitor
+	case "keybindings":
+		return p.Keyboard
+	}
+	return p.Variants[group]
+}
+
+func (p *profile) setVariant(group, name string) {
+	switch group {
+	case "monitors":
+		p.Monitor = name
+	case "keybindings":
+		p.Keyboard = name
+	default:
+		p.Variants[group] = name
+	}
+}
+
+// profileField is a variable as shown in the profile editor.
+type profileField struct {
+	Label string
+	Value *string
+	// Presets is the directory of the checkout the value picks a file from
+	Presets string
+	// Optional values may be empty
+	Optional bool
+}
+
+func (p *profile) fields() []profileField {
+	return []profileField{
+		{Label: "Username", Value: &p.User},
+		{Label: "Keybindings", Value: &p.Keyboard, Presets: hyprConfDir + "/keybindings"},
+		{Label: "Monitor preset", Value: &p.Monitor, Presets: hyprConfDir + "/monitors"},
+		{Label: "XKB layout", Value: &p.KbLayout},
+		{Label: "XKB variant", Value: &p.KbVariant, Optional: true},
+		{Label: "Terminal", Value: &p.Terminal},
+		{Label: "Browser", Value: &p.Browser},
+		{Label: "Editor", Value: &p.Editor},
+	}
+}
+
+// defaultProfile matches what the dotfiles hard-coded before they were
+// templated.
+func defaultProfile() profile {
+	p := profile{
+		User:     os.Getenv("USER"),
+		Keyboard: "fr",
+		Monitor:  "default",
+		KbLayout: "fr",
+		Terminal: "kitty",
+		Browser:  "zen-browser",
+		Editor:   "nvim",
+		Variants: make(map[string]string),
+	}
+	for _, group := range variantGroups {
+		if group.Default != "" {
+			p.Variants[group.Dir] = group.Default
+		}
+	}
+	if current, err := user.Current(); err == nil {
+		p.User = current.Username
+	}
+	return p
+}
+
+// profilePath returns ~/.config/dotfiles-installer/profile.json, honouring
+// XDG_CONFIG_HOME.
+func profilePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locating config directory: %w", err)
+	}
+	return filepath.Join(dir, "dotfiles-installer", "profile.json"), nil
+}
+
+// loadProfile reads the saved profile. Variables it doesn't set keep their
+// defaults.
+func loadProfile() (profile, error) {
+	p := defaultProfile()
+	path, err := profilePath()
+	if err != nil {
+		return p, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return p, fmt.Errorf("reading profile: %w", err)
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("parsing profile %s: %w", path, err)
+	}
+	if p.Variants == nil {
+		p.Variants = defaultProfile().Variants
+	}
+	return p, nil
+}
+
+func (p profile) save() error {
+	path, err := profilePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding profile: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing profile: %w", err)
+	}
+	return nil
+}
+
+// validate checks the variables before anything is rendered with them.
+func (p profile) validate(source string) error {
+	for _, field := range p.fields() {
+		value := *field.Value
+		if strings.TrimSpace(value) == "" && !field.Optional {
+			return fmt.Errorf("profile: %s is empty", field.Label)
+		}
+		if strings.ContainsAny(value, "\n\r\x00") {
+			return fmt.Errorf("profile: %s must be a single line", field.Label)
+		}
+		if field.Presets == "" {
+			continue
+		}
+		if _, ok := p.generated()[field.Presets+"/"+value+".conf"]; ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(source, field.Presets, value+".conf")); err != nil {
+			return fmt.Errorf("profile: %s %q is not one of %s", field.Label, value, strings.Join(presets(source, field.Presets), ", "))
+		}
+	}
+	for _, group := range variantGroups {
+		name := p.Variant(group.Dir)
+		if group.Default == "" || name == "" {
+			continue
+		}
+		dir := hyprConfDir + "/" + group.Dir
+		if _, err := os.Stat(filepath.Join(source, dir, name+".conf")); err != nil {
+			return fmt.Errorf("profile: %s %q is not one of %s", group.Label, name, strings.Join(presets(source, dir), ", "))
+		}
+	}
+	return nil
+}
+
+// generated returns the files the profile adds to the checkout, by path.
+func (p profile) generated() map[string][]byte {
+	files := make(map[string][]byte)
+	if p.Displays != "" {
+		files[hyprConfDir+"/monitors/"+detectedMonitors+".conf"] = []byte(p.Displays)
+	}
+	return files
+}
+
+// presets lists the .conf files of a directory of the checkout.
+func presets(source, dir string) []string {
+	matches, _ := filepath.Glob(filepath.Join(source, dir, "*.conf"))
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = strings.TrimSuffix(filepath.Base(match), ".conf")
+	}
+	return names
+}
+
+// renderTemplate executes a template of the checkout with the profile and
+// validates the result.
+func renderTemplate(source, path string, p profile) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, p); err != nil {
+		return nil, err
+	}
+	if err := validateRendered(source, out.Bytes(), p.generated()); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return out.Bytes(), nil
+}
+
+var hyprSourceLine = regexp.MustCompile(`(?m)^\s*source\s*=\s*~/(\S+)`)
+
+// validateRendered checks that the Hyprland files a rendered config sources
+// are shipped, so that a bad variable can't leave Hyprland without its
+// monitors or keybindings. Files the profile generates count as shipped.
+func validateRendered(source string, content []byte, generated map[string][]byte) error {
+	for _, match := range hyprSourceLine.FindAllSubmatch(content, -1) {
+		rel := string(match[1])
+		if _, ok := generated[rel]; ok {
+			continue
+		}
+		_, err := os.Stat(filepath.Join(source, rel))
+		if os.IsNotExist(err) {
+			_, err = os.Stat(filepath.Join(source, rel+templateSuffix))
+		}
+		if err != nil {
+			return fmt.Errorf("sources ~/%s, which the dotfiles don't have", rel)
+		}
+	}
+	return nil
+}
+
+// profileForm edits the profile from the dotfiles review.
+type profileForm struct {
+	profile profile
+	source  string
+	cursor  int
+	// editing is set while the value under the cursor is typed in
+	editing bool
+	input   string
+	err     error
+}
+
+func newProfileForm(p profile, source string) profileForm {
+	return profileForm{profile: p, source: source}
+}
+
+// updateProfileForm handles keys on the profile screen. Leaving it saves
+// the profile and rescans the dotfiles with it.
+func (m model) updateProfileForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	f := &m.form
+	fields := f.profile.fields()
+	field := fields[f.cursor]
+
+	if f.editing {
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return m, tea.Quit
+		case tea.KeyEsc:
+			f.editing = false
+		case tea.KeyEnter:
+			*field.Value = strings.TrimSpace(f.input)
+			f.editing = false
+		case tea.KeyBackspace:
+			if runes := []rune(f.input); len(runes) > 0 {
+				f.input = string(runes[:len(runes)-1])
+			}
+		case tea.KeySpace:
+			f.input += " "
+		case tea.KeyRunes:
+			f.input += string(msg.Runes)
+		}
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "up", "k":
+		f.cursor = max(f.cursor-1, 0)
+	case "down", "j":
+		f.cursor = min(f.cursor+1, len(fields)-1)
+	case "left", "h", "right", "l":
+		// Cycle through the presets shipped in the checkout
+		if field.Presets == "" {
+			break
+		}
+		names := presets(f.source, field.Presets)
+		if len(names) == 0 {
+			break
+		}
+		i := indexOf(names, *field.Value)
+		if msg.String() == "left" || msg.String() == "h" {
+			i = (i - 1 + len(names)) % len(names)
+		} else {
+			i = (i + 1) % len(names)
+		}
+		*field.Value = names[i]
+	case "enter":
+		f.editing, f.input = true, *field.Value
+	case "esc", "v":
+		if f.err = f.profile.validate(f.source); f.err != nil {
+			break
+		}
+		if f.err = f.profile.save(); f.err != nil {
+			break
+		}
+		m.editingProfile = false
+		edited := f.profile.fields()
+		for i, field := range m.review.profile.fields() {
+			*field.Value = *edited[i].Value
+		}
+		m.review = m.review.rescan(m.review.mode)
+	}
+	return m, nil
+}
+
+func (m model) profileView() string {
+	f := m.form
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("🧩 Machine Profile"))
+	result.WriteString("\n")
+	result.WriteString(descriptionStyle.Render("Templates (*" + templateSuffix + ") in share/dotfiles are rendered with these variables."))
+	result.WriteString("\n\n")
+
+	for i, field := range f.profile.fields() {
+		value := *field.Value
+		if f.editing && i == f.cursor {
+			value = f.input + "█"
+		}
+		line := fmt.Sprintf("%-16s %s", field.Label, value)
+		if field.Presets != "" && !(f.editing && i == f.cursor) {
+			line += "  ◂▸"
+		}
+		if i == f.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else {
+			result.WriteString(unselectedStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	if f.err != nil {
+		result.WriteString("\n")
+		result.WriteString(errorStyle.Render(f.err.Error()))
+		result.WriteString("\n")
+	}
+
+	if f.editing {
+		result.WriteString("\nType the value, ENTER to keep it, ESC to cancel")
+	} else {
+		result.WriteString("\nUse ↑↓ to navigate, ENTER to edit, ←→ to pick a preset, ESC to save and go back")
+	}
+	return result.String()
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	reportJSONName     = "report.json"
+	reportMarkdownName = "report.md"
+
+	// logExcerptLines is the number of output lines kept for a failed step.
+	logExcerptLines = 20
+)
+
+type stepStatus string
+
+const (
+	stepSucceeded stepStatus = "succeeded"
+	stepFailed    stepStatus = "failed"
+	stepNotRun    stepStatus = "not run"
+)
+
+// stepReport is the outcome of a single unit of the installation.
+type stepReport struct {
+	Function   string     `json:"function"`
+	Name       string     `json:"name"`
+	Status     stepStatus `json:"status"`
+	ExitCode   int        `json:"exit_code"`
+	Duration   float64    `json:"duration_seconds"`
+	Failures   []string   `json:"failures,omitempty"`
+	Warnings   []string   `json:"warnings,omitempty"`
+	LogExcerpt []string   `json:"log_excerpt,omitempty"`
+}
+
+// runReport is the structured post-install report kept in the run directory.
+type runReport struct {
+	Run            string       `json:"run"`
+	Started        time.Time    `json:"started"`
+	Finished       time.Time    `json:"finished"`
+	Duration       float64      `json:"duration_seconds"`
+	SelectedSteps  []string     `json:"selected_steps"`
+	Steps          []stepReport `json:"steps"`
+	FailedPackages []string     `json:"failed_packages"`
+	Warnings       []string     `json:"warnings"`
+	BackupDir      string       `json:"backup_dir"`
+	Errors         []string     `json:"errors,omitempty"`
+}
+
+// newRunReport starts the report of a run executing plan.
+func newRunReport(run *runState, plan installPlan) *runReport {
+	report := &runReport{
+		Run:            run.ID,
+		Started:        run.Started,
+		SelectedSteps:  []string{},
+		Steps:          []stepReport{},
+		FailedPackages: []string{},
+		Warnings:       []string{},
+		BackupDir:      run.backupDir(),
+	}
+	for _, step := range plan.Steps {
+		report.SelectedSteps = append(report.SelectedSteps, step.Function)
+	}
+	return report
+}
+
+// record adds the result of a unit. ok is false when the script exited
+// while the unit was running.
+func (r *runReport) record(unit installUnit, started time.Time, result unitResult, ok bool) {
+	step := stepReport{
+		Function: unit.Function,
+		Name:     unit.Name,
+		Status:   stepSucceeded,
+		ExitCode: result.ExitCode,
+		Duration: time.Since(started).Seconds(),
+	}
+	// The step runner records a failed unit under its own name as well
+	for _, failure := range result.Failures {
+		if failure != unit.Name {
+			step.Failures = append(step.Failures, failure)
+		}
+	}
+	if !ok {
+		step.ExitCode = -1
+	}
+	if !ok || result.ExitCode != 0 || len(step.Failures) > 0 {
+		step.Status = stepFailed
+		step.LogExcerpt = result.Output
+		if len(step.LogExcerpt) > logExcerptLines {
+			step.LogExcerpt = step.LogExcerpt[len(step.LogExcerpt)-logExcerptLines:]
+		}
+	}
+
+	for _, line := range result.Output {
+		if isWarningLine(line) {
+			step.Warnings = append(step.Warnings, strings.TrimSpace(line))
+		}
+	}
+	r.Warnings = append(r.Warnings, step.Warnings...)
+
+	// _installPackages and _installAurPackages record the packages they
+	// could not install as "pacman: <pkgs>" and "AUR: <pkgs>"
+	for _, failure := range result.Failures {
+		for _, prefix := range []string{"pacman: ", "AUR: "} {
+			if packages, found := strings.CutPrefix(failure, prefix); found {
+				r.FailedPackages = append(r.FailedPackages, strings.Fields(packages)...)
+			}
+		}
+	}
+
+	r.Steps = append(r.Steps, step)
+}
+
+// finish marks the units that never ran and stamps the end of the run.
+func (r *runReport) finish(units []installUnit) {
+	recorded := make(map[string]bool)
+	for _, step := range r.Steps {
+		recorded[step.Function] = true
+	}
+	for _, unit := range units {
+		if !recorded[unit.Function] {
+			r.Steps = append(r.Steps, stepReport{Function: unit.Function, Name: unit.Name, Status: stepNotRun})
+		}
+	}
+
+	r.Finished = time.Now()
+	r.Duration = r.Finished.Sub(r.Started).Seconds()
+}
+
+// failed returns the steps that did not succeed.
+func (r *runReport) failed() []stepReport {
+	var steps []stepReport
+	for _, step := range r.Steps {
+		if step.Status == stepFailed {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// write saves the report as JSON and Markdown into dir.
+func (r *runReport) write(dir string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, reportJSONName), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, reportMarkdownName), []byte(r.markdown()), 0600); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
+
+// loadRunReport reads the JSON report of the run in dir.
+func loadRunReport(dir string) (*runReport, error) {
+	data, err := os.ReadFile(filepath.Join(dir, reportJSONName))
+	if err != nil {
+		return nil, fmt.Errorf("reading report: %w", err)
+	}
+
+	var report runReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parsing report: %w", err)
+	}
+	return &report, nil
+}
+
+func (r *runReport) markdown() string {
+	var md strings.Builder
+	md.WriteString(fmt.Sprintf("# Installation report %s\n\n", r.Run))
+	md.WriteString(fmt.Sprintf("- Started: %s\n", r.Started.Format(time.DateTime)))
+	md.WriteString(fmt.Sprintf("- Duration: %s\n", formatSeconds(r.Duration)))
+	md.WriteString(fmt.Sprintf("- Result: %s\n", r.summary()))
+	md.WriteString(fmt.Sprintf("- Backup directory: `%s`\n", r.BackupDir))
+
+	md.WriteString("\n## Steps\n\n")
+	md.WriteString("| Step | Function | Status | Exit code | Duration |\n")
+	md.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, step := range r.Steps {
+		exitCode, duration := "", ""
+		if step.Status != stepNotRun {
+			exitCode = fmt.Sprint(step.ExitCode)
+			duration = formatSeconds(step.Duration)
+		}
+		md.WriteString(fmt.Sprintf("| %s | `%s` | %s %s | %s | %s |\n",
+			step.Name, step.Function, step.Status.icon(), step.Status, exitCode, duration))
+	}
+
+	if len(r.FailedPackages) > 0 {
+		md.WriteString("\n## Failed packages\n\n")
+		for _, pkg := range r.FailedPackages {
+			md.WriteString(fmt.Sprintf("- `%s`\n", pkg))
+		}
+	}
+
+	if len(r.Warnings) > 0 {
+		md.WriteString("\n## Warnings\n\n")
+		for _, warning := range r.Warnings {
+			md.WriteString(fmt.Sprintf("- %s\n", warning))
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		md.WriteString("\n## Installer errors\n\n")
+		for _, err := range r.Errors {
+			md.WriteString(fmt.Sprintf("- %s\n", err))
+		}
+	}
+
+	if failed := r.failed(); len(failed) > 0 {
+		md.WriteString("\n## Failures\n")
+		for _, step := range failed {
+			md.WriteString(fmt.Sprintf("\n### %s (exit code %d)\n\n", step.Name, step.ExitCode))
+			for _, failure := range step.Failures {
+				md.WriteString(fmt.Sprintf("- %s\n", failure))
+			}
+			if len(step.Failures) > 0 {
+				md.WriteString("\n")
+			}
+			md.WriteString("```\n")
+			for _, line := range step.LogExcerpt {
+				md.WriteString(line + "\n")
+			}
+			md.WriteString("```\n")
+		}
+	}
+	return md.String()
+}
+
+// summary describes the outcome of the run in one line.
+func (r *runReport) summary() string {
+	failed, notRun := 0, 0
+	for _, step := range r.Steps {
+		switch step.Status {
+		case stepFailed:
+			failed++
+		case stepNotRun:
+			notRun++
+		}
+	}
+
+	switch {
+	case failed == 0 && notRun == 0:
+		return fmt.Sprintf("all %d steps succeeded", len(r.Steps))
+	case notRun == 0:
+		return fmt.Sprintf("%d of %d steps failed", failed, len(r.Steps))
+	default:
+		return fmt.Sprintf("%d of %d steps failed, %d not run", failed, len(r.Steps), notRun)
+	}
+}
+
+func (s stepStatus) icon() string {
+	switch s {
+	case stepSucceeded:
+		return "✅"
+	case stepFailed:
+		return "❌"
+	default:
+		return "⏭️"
+	}
+}
+
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(100 * time.Millisecond).String()
+}
+
+// isErrorLine and isWarningLine classify a line of script output.
+func isErrorLine(line string) bool {
+	return strings.Contains(line, "ERROR") || strings.Contains(line, "error")
+}
+
+func isWarningLine(line string) bool {
+	return strings.Contains(line, "WARNING") || strings.Contains(line, "warning") || strings.Contains(line, "Warning")
+}
+
+// reportModel shows a saved report, one step at a time.
+type reportModel struct {
+	report *runReport
+	cursor int
+}
+
+func (m reportModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m reportModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.report.Steps)-1 {
+				m.cursor++
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m reportModel) View() string {
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("📄 Installation Report " + m.report.Run))
+	result.WriteString("\n")
+	result.WriteString(fmt.Sprintf("Started %s, took %s: %s\n",
+		m.report.Started.Format(time.DateTime), formatSeconds(m.report.Duration), m.report.summary()))
+	result.WriteString(descriptionStyle.Render("Backups: " + m.report.BackupDir))
+	result.WriteString("\n\n")
+
+	for i, step := range m.report.Steps {
+		line := fmt.Sprintf("%s %s", step.Status.icon(), step.Name)
+		if step.Status != stepNotRun {
+			line += fmt.Sprintf(" (%s)", formatSeconds(step.Duration))
+		}
+		switch {
+		case i == m.cursor:
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		case step.Status == stepFailed:
+			result.WriteString(errorStyle.Render("  " + line))
+		case step.Status == stepNotRun:
+			result.WriteString(unselectedStyle.Render("  " + line))
+		default:
+			result.WriteString(successStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	if len(m.report.Steps) > 0 {
+		result.WriteString("\n")
+		result.WriteString(m.stepView(m.report.Steps[m.cursor]))
+	}
+
+	if len(m.report.FailedPackages) > 0 {
+		result.WriteString("\n")
+		result.WriteString(errorStyle.Render("Failed packages: " + strings.Join(m.report.FailedPackages, ", ")))
+		result.WriteString("\n")
+	}
+	for _, err := range m.report.Errors {
+		result.WriteString(errorStyle.Render("Installer error: " + err))
+		result.WriteString("\n")
+	}
+
+	result.WriteString("\nUse ↑↓ to select a step, 'q' to quit")
+	return result.String()
+}
+
+func (m reportModel) stepView(step stepReport) string {
+	var result strings.Builder
+	result.WriteString(categoryStyle.Render(fmt.Sprintf("%s (%s)", step.Name, step.Function)))
+	result.WriteString("\n")
+	if step.Status == stepNotRun {
+		result.WriteString(descriptionStyle.Render("This step did not run."))
+		result.WriteString("\n")
+		return result.String()
+	}
+
+	result.WriteString(descriptionStyle.Render(fmt.Sprintf("Status: %s, exit code %d", step.Status, step.ExitCode)))
+	result.WriteString("\n")
+	for _, failure := range step.Failures {
+		result.WriteString(errorStyle.Render("  • " + failure))
+		result.WriteString("\n")
+	}
+	for _, warning := range step.Warnings {
+		result.WriteString(warningStyle.Render("  • " + warning))
+		result.WriteString("\n")
+	}
+	for _, line := range step.LogExcerpt {
+		result.WriteString(descriptionStyle.Render(line))
+		result.WriteString("\n")
+	}
+	return result.String()
+}
+
+// reportCommand implements `dotfiles-installer report [run]`.
+func reportCommand(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: dotfiles-installer report [run]")
+	}
+	id := ""
+	if len(args) == 1 {
+		id = args[0]
+	}
+
+	dir, err := findRun(id)
+	if err != nil {
+		return err
+	}
+	report, err := loadRunReport(dir)
+	if err != nil {
+		return err
+	}
+
+	p := tea.NewProgram(reportModel{report: report}, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
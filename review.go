@@ -0,0 +1,670 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	diffAddStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981"))
+	diffRemoveStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444"))
+	diffHunkStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#3B82F6"))
+)
+
+// dotfilesReview is the state of the dotfiles screen, where every file from
+// share/dotfiles is approved before the Dotfiles step writes it.
+type dotfilesReview struct {
+	mode     deployMode
+	source   string
+	home     string
+	excluded []string
+	// planned are the packages the installation installs
+	planned  []string
+	profile  profile
+	files    []dotfile
+	expanded map[string]bool
+	cursor   int
+	offset   int
+	err      error
+
+	// passphrase decrypts the encrypted files, which are locked and left
+	// out without it
+	passphrase string
+	locked     []string
+	// unlocking is set while the passphrase is typed in
+	unlocking bool
+	input     string
+
+	// hypr are the problems of the Hyprland config the deploy would leave
+	hypr []hyprIssue
+
+	// diff is the diff or the list being viewed, if any
+	diff       []string
+	diffTitle  string
+	diffOffset int
+}
+
+// reviewRow is a line of the dotfiles tree: a directory or a file.
+type reviewRow struct {
+	Dir   string
+	File  int
+	Depth int
+}
+
+// newDotfilesReview scans the dotfiles, leaving out the excluded
+// directories of deselected applications, rendering the templates with the
+// profile and decrypting the encrypted files with the passphrase. The
+// planned packages are expected by the checks of the Hyprland config.
+func newDotfilesReview(mode deployMode, excluded, planned []string, p profile, passphrase string) dotfilesReview {
+	review := dotfilesReview{mode: mode, excluded: excluded, planned: planned, profile: p, passphrase: passphrase, expanded: map[string]bool{"": true}}
+	// Symlinks need an absolute source
+	source, err := filepath.Abs(dotfilesSourceDir)
+	var home string
+	if err == nil {
+		home, err = os.UserHomeDir()
+	}
+	var tree *dotfilesTree
+	if err == nil {
+		review.source = source
+		tree, err = loadDotfilesTree(source, p)
+	}
+	if err == nil {
+		tree.passphrase = passphrase
+		review.files, review.locked, err = scanDotfiles(tree, home, mode)
+	}
+	files := review.files[:0]
+	for _, file := range review.files {
+		if !hasAnyPrefix(file.Path, excluded) {
+			files = append(files, file)
+		}
+	}
+	review.files = files
+	review.home = home
+	review.err = err
+	if err == nil {
+		review.hypr = checkHyprConfig(deployedReader(review.files, home), planned)
+	}
+	return review
+}
+
+// rescan scans the dotfiles again in mode, keeping the folding, the
+// position in the list and the actions chosen for files whose state hasn't
+// changed, as long as mode allows them.
+func (r dotfilesReview) rescan(mode deployMode) dotfilesReview {
+	review := newDotfilesReview(mode, r.excluded, r.planned, r.profile, r.passphrase)
+	review.expanded = r.expanded
+
+	previous := make(map[string]dotfile, len(r.files))
+	for _, file := range r.files {
+		previous[file.Path] = file
+	}
+	for i, file := range review.files {
+		old, ok := previous[file.Path]
+		if !ok || old.State != file.State {
+			continue
+		}
+		if action, ok := review.actionFor(file, old.Action); ok {
+			review.files[i].Action = action
+		}
+	}
+	if review.err == nil {
+		review.hypr = checkHyprConfig(deployedReader(review.files, review.home), review.planned)
+	}
+
+	rows := len(review.rows())
+	review.cursor = max(min(r.cursor, rows-1), 0)
+	review.offset = max(min(r.offset, review.cursor), 0)
+	return review
+}
+
+// file returns the dotfile at path, relative to $HOME.
+func (r dotfilesReview) file(path string) (dotfile, bool) {
+	for _, file := range r.files {
+		if file.Path == path {
+			return file, true
+		}
+	}
+	return dotfile{}, false
+}
+
+// rows flattens the expanded part of the tree, directories first.
+func (r dotfilesReview) rows() []reviewRow {
+	paths := make([]string, len(r.files))
+	for i, file := range r.files {
+		paths[i] = file.Path
+	}
+	return treeRows(paths, r.expanded)
+}
+
+// treeRows lays slash-separated paths out as a tree, listing what is below
+// the expanded directories. File rows hold the index of their path.
+func treeRows(paths []string, expanded map[string]bool) []reviewRow {
+	var rows []reviewRow
+	appendTreeRows(&rows, paths, expanded, "", 0)
+	return rows
+}
+
+func appendTreeRows(rows *[]reviewRow, paths []string, expanded map[string]bool, dir string, depth int) {
+	seen := make(map[string]bool)
+	var dirs []string
+	var files []int
+	for i, p := range paths {
+		rest, ok := strings.CutPrefix(p, dir)
+		if !ok {
+			continue
+		}
+		if name, _, nested := strings.Cut(rest, "/"); nested {
+			if !seen[name] {
+				seen[name] = true
+				dirs = append(dirs, dir+name+"/")
+			}
+		} else {
+			files = append(files, i)
+		}
+	}
+	sort.Strings(dirs)
+
+	for _, sub := range dirs {
+		*rows = append(*rows, reviewRow{Dir: sub, File: -1, Depth: depth})
+		if expanded[sub] {
+			appendTreeRows(rows, paths, expanded, sub, depth+1)
+		}
+	}
+	for _, i := range files {
+		*rows = append(*rows, reviewRow{File: i, Depth: depth})
+	}
+}
+
+// under returns the indexes of the files a row stands for.
+func (r dotfilesReview) under(row reviewRow) []int {
+	if row.File >= 0 {
+		return []int{row.File}
+	}
+	var files []int
+	for i, file := range r.files {
+		if strings.HasPrefix(file.Path, row.Dir) {
+			files = append(files, i)
+		}
+	}
+	return files
+}
+
+// setAction applies an action to the files of a row. Identical and linked
+// files are never written, new files have nothing to keep both of or to
+// adopt, and only copies can be kept next to each other.
+func (r dotfilesReview) setAction(row reviewRow, action dotfileAction) {
+	for _, i := range r.under(row) {
+		if allowed, ok := r.actionFor(r.files[i], action); ok {
+			r.files[i].Action = allowed
+		}
+	}
+}
+
+// actionFor returns the action a file gets when action is chosen for it in
+// the review's mode, or false if it keeps the one it has.
+func (r dotfilesReview) actionFor(file dotfile, action dotfileAction) (dotfileAction, bool) {
+	switch {
+	case file.State == dotfileIdentical || file.State == dotfileLinked:
+		return "", false
+	case file.State == dotfileNew && (action == dotfileKeepBoth || action == dotfileAdopt):
+		return dotfileAccept, true
+	case action == dotfileKeepBoth && r.mode == deployLink,
+		action == dotfileAdopt && (r.mode == deployCopy || file.Rendered != nil):
+		return "", false
+	}
+	return action, true
+}
+
+// actionKeys are the keys setting the action of a file or directory.
+var actionKeys = map[string]dotfileAction{"a": dotfileAccept, "s": dotfileSkip, "b": dotfileKeepBoth, "o": dotfileAdopt}
+
+func (m model) updateDotfilesReview(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	r := &m.review
+	page := m.listHeight()
+
+	if r.diff != nil {
+		switch msg.String() {
+		case "ctrl+c":
+			return m, tea.Quit
+		case "esc", "q", "d", "c":
+			r.diff, r.diffOffset = nil, 0
+		case "up", "k":
+			r.diffOffset = max(r.diffOffset-1, 0)
+		case "down", "j":
+			r.diffOffset = max(min(r.diffOffset+1, len(r.diff)-page), 0)
+		case "pgup":
+			r.diffOffset = max(r.diffOffset-page, 0)
+		case "pgdown":
+			r.diffOffset = max(min(r.diffOffset+page, len(r.diff)-page), 0)
+		}
+		return m, nil
+	}
+
+	if r.unlocking {
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return m, tea.Quit
+		case tea.KeyEsc:
+			r.unlocking, r.input = false, ""
+		case tea.KeyEnter:
+			r.passphrase = r.input
+			*r = r.rescan(r.mode)
+		case tea.KeyBackspace:
+			if runes := []rune(r.input); len(runes) > 0 {
+				r.input = string(runes[:len(runes)-1])
+			}
+		case tea.KeySpace:
+			r.input += " "
+		case tea.KeyRunes:
+			r.input += string(msg.Runes)
+		}
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "v", "g":
+		// The profile is read again, so that the proposed environment is
+		// only saved once the installation starts
+		prof, err := loadProfile()
+		if err != nil {
+			r.err = err
+			return m, nil
+		}
+		if msg.String() == "v" {
+			m.editingProfile = true
+			m.form = newProfileForm(prof, r.source)
+		} else {
+			m.editingSettings = true
+			m.settings = newSettingsForm(r.source, r.home, prof, selectedOrInstalled(m.selectedSteps), false)
+		}
+		return m, nil
+	case "w":
+		// The config as it would be written, the arrangement is kept in
+		// the profile and neither the checkout nor $HOME is changed
+		file, ok := r.file(waybarConfig)
+		if !ok {
+			r.err = fmt.Errorf("~/%s isn't written with the dotfiles", waybarConfig)
+			return m, nil
+		}
+		data, err := file.content()
+		var form waybarForm
+		if err == nil {
+			form, err = loadWaybarForm(data, "~/"+waybarConfig+" as the dotfiles write it, arranged in the machine profile", []string{r.source, r.home}, r.planned)
+		}
+		if err != nil {
+			r.err = err
+			return m, nil
+		}
+		m.editingWaybar, m.waybar = true, form
+		return m, nil
+	case "e":
+		// Like the Waybar config, the changes are kept in the profile
+		file, ok := r.file(autostartConf)
+		if !ok {
+			r.err = fmt.Errorf("~/%s isn't written with the dotfiles", autostartConf)
+			return m, nil
+		}
+		data, err := file.content()
+		var shipped []byte
+		if err == nil {
+			shipped, err = os.ReadFile(file.Source)
+		}
+		if err != nil {
+			r.err = err
+			return m, nil
+		}
+		m.editingAutostart = true
+		m.autostart = loadAutostartForm(data, "~/"+autostartConf+" as the dotfiles write it, changed in the machine profile", []string{r.source, r.home}, r.planned)
+		m.autostart.shipped = parseAutostart(strings.Split(string(shipped), "\n"))
+		return m, nil
+	case "x":
+		// The profile is read again, so that the proposed environment is
+		// only saved once the installation starts
+		prof, err := loadProfile()
+		var layouts []xkbLayout
+		if err == nil {
+			layouts, err = loadXKBLayouts()
+		}
+		if err != nil {
+			r.err = err
+			return m, nil
+		}
+		m.editingKeyboard = true
+		m.keyboard = newKeyboardForm(r.source, r.home, prof, layouts, false, m.listHeight())
+		return m, nil
+	case "n":
+		prof, err := loadProfile()
+		var outputs []monitorOutput
+		var from string
+		if err == nil {
+			outputs, from, err = detectMonitors()
+		}
+		if err != nil {
+			r.err = err
+			return m, nil
+		}
+		m.editingMonitors = true
+		m.monitors = newMonitorsForm(r.source, r.home, prof, outputs, from, true)
+		return m, nil
+	case "p":
+		// Also offered after a wrong passphrase made the scan fail
+		if len(r.locked) > 0 || r.passphrase != "" {
+			r.unlocking, r.input = true, ""
+		}
+		return m, nil
+	}
+
+	rows := r.rows()
+	if len(rows) == 0 {
+		switch msg.String() {
+		case "ctrl+c", "q":
+			return m, tea.Quit
+		case "esc":
+			m.reviewingDotfiles = false
+			m.reviewingPlan = true
+		case "enter":
+			// A failed scan has to be fixed first, e.g. in the profile
+			if r.err == nil {
+				return m.beginInstallation()
+			}
+		}
+		return m, nil
+	}
+	row := rows[r.cursor]
+
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "esc":
+		m.reviewingDotfiles = false
+		m.reviewingPlan = true
+	case "enter":
+		return m.beginInstallation()
+	case "up", "k":
+		r.cursor = max(r.cursor-1, 0)
+	case "down", "j":
+		r.cursor = min(r.cursor+1, len(rows)-1)
+	case "pgup":
+		r.cursor = max(r.cursor-page, 0)
+	case "pgdown":
+		r.cursor = min(r.cursor+page, len(rows)-1)
+	case "right", "l", " ", "space":
+		if row.File < 0 {
+			r.expanded[row.Dir] = !r.expanded[row.Dir] || msg.String() == "right" || msg.String() == "l"
+		}
+	case "left", "h":
+		if row.File < 0 && r.expanded[row.Dir] {
+			r.expanded[row.Dir] = false
+		} else if parent := r.parent(row); parent != "" {
+			// Jump to the parent directory and fold it
+			r.expanded[parent] = false
+			for i, candidate := range r.rows() {
+				if candidate.Dir == parent {
+					r.cursor = i
+				}
+			}
+		}
+	case "a", "s", "b", "o":
+		r.setAction(row, actionKeys[msg.String()])
+		// Skipped files leave the Hyprland config in $HOME as it is
+		r.hypr = checkHyprConfig(deployedReader(r.files, r.home), r.planned)
+	case "c":
+		if len(r.hypr) == 0 {
+			break
+		}
+		r.diff, r.diffTitle, r.diffOffset = nil, "🔎 Hyprland Config Check", 0
+		for _, issue := range r.hypr {
+			r.diff = append(r.diff, issue.String())
+		}
+	case "m":
+		// Switching modes rescans, as the states differ
+		mode := deployLink
+		if r.mode == deployLink {
+			mode = deployCopy
+		}
+		*r = r.rescan(mode)
+		return m, nil
+	case "d":
+		if row.File < 0 {
+			break
+		}
+		if state := r.files[row.File].State; state != dotfileIdentical && state != dotfileLinked {
+			r.diff, r.err = r.files[row.File].diff()
+			r.diffTitle = "🔍 Changes to " + r.files[row.File].Path
+			if r.err == nil && len(r.diff) == 0 {
+				r.diff = []string{"The contents are identical."}
+			}
+			r.diffOffset = 0
+		}
+	}
+
+	// Keep the cursor visible
+	if r.cursor < r.offset {
+		r.offset = r.cursor
+	} else if r.cursor >= r.offset+page {
+		r.offset = r.cursor - page + 1
+	}
+	return m, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parent returns the directory containing a row.
+func (r dotfilesReview) parent(row reviewRow) string {
+	p := row.Dir
+	if row.File >= 0 {
+		p = r.files[row.File].Path
+	}
+	dir := path.Dir(strings.TrimSuffix(p, "/"))
+	if dir == "." {
+		return ""
+	}
+	return dir + "/"
+}
+
+// listHeight is the number of list lines that fit on screen.
+func (m model) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-12, 5)
+}
+
+func (m model) dotfilesView() string {
+	r := m.review
+	var result strings.Builder
+
+	if r.diff != nil {
+		result.WriteString(titleStyle.Render(r.diffTitle))
+		result.WriteString("\n")
+		end := min(r.diffOffset+m.listHeight(), len(r.diff))
+		for _, line := range r.diff[r.diffOffset:end] {
+			result.WriteString(renderDiffLine(line))
+			result.WriteString("\n")
+		}
+		result.WriteString(fmt.Sprintf("\nLines %d-%d of %d. Use ↑↓/PgUp/PgDn to scroll, ESC to go back", r.diffOffset+1, end, len(r.diff)))
+		return result.String()
+	}
+
+	if r.unlocking {
+		result.WriteString(titleStyle.Render("🔒 Decrypt Dotfiles"))
+		result.WriteString("\n")
+		result.WriteString(descriptionStyle.Render("Encrypted files (*" + ageSuffix + ", *" + gpgSuffix + ") in share/dotfiles are decrypted with this passphrase."))
+		result.WriteString("\n\n")
+		result.WriteString(selectedStyle.Render("▶ Passphrase  " + strings.Repeat("•", len([]rune(r.input))) + "█"))
+		result.WriteString("\n\nType the passphrase, ENTER to decrypt, ESC to cancel")
+		return result.String()
+	}
+
+	result.WriteString(titleStyle.Render("📂 Review Dotfiles"))
+	result.WriteString("\n")
+
+	counts := make(map[dotfileState]int)
+	for _, file := range r.files {
+		counts[file.State]++
+	}
+	if r.mode == deployLink {
+		result.WriteString(fmt.Sprintf("Mode: symlink. %d new, %d conflict, %d linked\n\n",
+			counts[dotfileNew], counts[dotfileConflict], counts[dotfileLinked]))
+	} else {
+		result.WriteString(fmt.Sprintf("Mode: copy. %d new, %d would overwrite, %d identical\n\n",
+			counts[dotfileNew], counts[dotfileChanged], counts[dotfileIdentical]))
+	}
+	if len(r.locked) > 0 {
+		result.WriteString(warningStyle.Render(fmt.Sprintf("🔒 %d encrypted file(s) left out, press p to enter the passphrase", len(r.locked))))
+		result.WriteString("\n\n")
+	}
+	if secrets := r.withSecrets(); secrets > 0 {
+		result.WriteString(warningStyle.Render(fmt.Sprintf("⚠️  %d file(s) look like they contain secrets; consider encrypting them", secrets)))
+		result.WriteString("\n\n")
+	}
+
+	if errors, warnings := countHyprIssues(r.hypr); errors > 0 {
+		result.WriteString(errorStyle.Render(fmt.Sprintf("❌ The Hyprland config would have %d error(s) and %d warning(s), press c to list them", errors, warnings)))
+		result.WriteString("\n\n")
+	} else if warnings > 0 {
+		result.WriteString(warningStyle.Render(fmt.Sprintf("⚠️  The Hyprland config would have %d warning(s), press c to list them", warnings)))
+		result.WriteString("\n\n")
+	}
+
+	rows := r.rows()
+	end := min(r.offset+m.listHeight(), len(rows))
+	for i := r.offset; i < end; i++ {
+		line := strings.Repeat("  ", rows[i].Depth) + r.rowLabel(rows[i])
+		if i == r.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else {
+			result.WriteString(r.rowStyle(rows[i]).Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	if r.err != nil {
+		result.WriteString("\n")
+		result.WriteString(errorStyle.Render(r.err.Error()))
+		result.WriteString("\n")
+	}
+
+	result.WriteString("\nUse ↑↓ to navigate, →← to expand or fold, d to show changes, c to list the Hyprland config problems, m to switch between copy and symlink, v to edit the machine profile, g to edit the ML4W settings, w to arrange the Waybar modules, e to edit the autostart commands, x to pick the keyboard layout, n to arrange the displays\n")
+	if len(r.locked) > 0 || r.passphrase != "" {
+		result.WriteString("p to enter the passphrase of the encrypted files\n")
+	}
+	if r.mode == deployLink {
+		result.WriteString("a accept (replaces files in the way), s skip, o adopt (moves the file into the checkout), for a file or a whole directory\n")
+	} else {
+		result.WriteString("a accept, s skip, b keep both (writes *" + keepBothSuffix + "), for a file or a whole directory\n")
+	}
+	result.WriteString("Press ENTER to start installation, ESC to go back, 'q' to quit")
+	return result.String()
+}
+
+// renderDiffLine colours a line of a unified diff.
+func renderDiffLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return categoryStyle.Render(line)
+	case strings.HasPrefix(line, "@@"):
+		return diffHunkStyle.Render(line)
+	case strings.HasPrefix(line, "+"):
+		return diffAddStyle.Render(line)
+	case strings.HasPrefix(line, "-"):
+		return diffRemoveStyle.Render(line)
+	default:
+		return line
+	}
+}
+
+func (r dotfilesReview) rowLabel(row reviewRow) string {
+	if row.File >= 0 {
+		file := r.files[row.File]
+		label := fmt.Sprintf("%s  %s", path.Base(file.Path), file.State)
+		switch {
+		case file.Note != "":
+			label += fmt.Sprintf(" (%s)", file.Note)
+		case file.Strategy == mergeKeep:
+			label += " (kept if present)"
+		case file.Strategy != "" && file.State == dotfileChanged:
+			label = fmt.Sprintf("%s  would merge (%s)", path.Base(file.Path), file.Strategy)
+		}
+		switch {
+		case file.Encrypted:
+			label += " (decrypted)"
+		case len(file.Secrets) > 0:
+			label += fmt.Sprintf(" (⚠ %s)", file.Secrets[0])
+		}
+		if file.State != dotfileIdentical && file.State != dotfileLinked {
+			label += fmt.Sprintf(" → %s", file.Action)
+		}
+		return label
+	}
+
+	marker := "▸"
+	if r.expanded[row.Dir] {
+		marker = "▾"
+	}
+	counts := make(map[dotfileState]int)
+	actions := make(map[dotfileAction]bool)
+	for _, i := range r.under(row) {
+		counts[r.files[i].State]++
+		if r.files[i].State != dotfileIdentical && r.files[i].State != dotfileLinked {
+			actions[r.files[i].Action] = true
+		}
+	}
+
+	label := fmt.Sprintf("%s %s  %d new, %d would overwrite, %d identical",
+		marker, path.Base(row.Dir)+"/", counts[dotfileNew], counts[dotfileChanged], counts[dotfileIdentical])
+	if r.mode == deployLink {
+		label = fmt.Sprintf("%s %s  %d new, %d conflict, %d linked",
+			marker, path.Base(row.Dir)+"/", counts[dotfileNew], counts[dotfileConflict], counts[dotfileLinked])
+	}
+	switch len(actions) {
+	case 0:
+	case 1:
+		for action := range actions {
+			label += fmt.Sprintf(" → %s", action)
+		}
+	default:
+		label += " → mixed"
+	}
+	return label
+}
+
+// withSecrets counts the files that look like they contain secrets.
+func (r dotfilesReview) withSecrets() int {
+	count := 0
+	for _, file := range r.files {
+		if len(file.Secrets) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func (r dotfilesReview) rowStyle(row reviewRow) lipgloss.Style {
+	if row.File < 0 {
+		return categoryStyle.UnsetMarginTop().UnsetMarginLeft()
+	}
+	file := r.files[row.File]
+	switch {
+	case file.State == dotfileIdentical || file.State == dotfileLinked || file.Action == dotfileSkip:
+		return unselectedStyle
+	case file.State == dotfileChanged || file.State == dotfileConflict:
+		return warningStyle
+	default:
+		return successStyle
+	}
+}
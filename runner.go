@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// unitDoneMarker is printed by the step runner after each unit, followed by
+// the unit's function and exit code.
+const unitDoneMarker = "::unit-done::"
+
+// unitFailedMarker is printed for every FAILED_STEPS entry a unit added.
+const unitFailedMarker = "::failed::"
+
+// unitResult is the outcome of a single unit reported by the step runner.
+type unitResult struct {
+	Function string
+	ExitCode int
+	Output   []string
+	Failures []string
+}
+
+// stepRunner drives the generated install script, which sources the
+// libraries once and executes one unit at a time as requested.
+type stepRunner struct {
+	cmd     *exec.Cmd
+	units   *os.File
+	results chan unitResult
+
+	// partial holds the output of a unit the script exited during.
+	partial unitResult
+}
+
+// startStepRunner starts the install script. Units are requested on file
+// descriptor 3 and every other line of output is passed to output.
+func startStepRunner(script *installScript, env []string, output func(string)) (*stepRunner, error) {
+	unitsReader, unitsWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating unit pipe: %w", err)
+	}
+
+	cmd := exec.Command("bash", script.path)
+	cmd.Dir, _ = os.Getwd()
+	cmd.Env = append(os.Environ(), env...)
+	cmd.ExtraFiles = []*os.File{unitsReader}
+
+	// Get stdout pipe to read output in real-time
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		unitsReader.Close()
+		unitsWriter.Close()
+		return nil, fmt.Errorf("getting stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		unitsReader.Close()
+		unitsWriter.Close()
+		return nil, fmt.Errorf("starting install script: %w", err)
+	}
+	// The script holds its own copy of the read end now
+	unitsReader.Close()
+
+	r := &stepRunner{
+		cmd:     cmd,
+		units:   unitsWriter,
+		results: make(chan unitResult),
+	}
+	go r.read(stdout, output)
+	return r, nil
+}
+
+func (r *stepRunner) read(stdout io.Reader, output func(string)) {
+	defer close(r.results)
+
+	var current unitResult
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields := strings.Fields(line); len(fields) == 3 && fields[0] == unitDoneMarker {
+			current.Function = fields[1]
+			current.ExitCode, _ = strconv.Atoi(fields[2])
+			r.results <- current
+			current = unitResult{}
+			continue
+		}
+		if failure, ok := strings.CutPrefix(line, unitFailedMarker+" "); ok {
+			current.Failures = append(current.Failures, failure)
+			continue
+		}
+		current.Output = append(current.Output, line)
+		output(line)
+	}
+	r.partial = current
+}
+
+// run executes a unit and waits for it to finish. ok is false when the
+// script exited before reporting the unit, e.g. after a failed preflight;
+// result then holds whatever the unit printed.
+func (r *stepRunner) run(function string) (result unitResult, ok bool) {
+	if _, err := fmt.Fprintln(r.units, function); err != nil {
+		return unitResult{Function: function}, false
+	}
+	result, ok = <-r.results
+	if !ok {
+		result = r.partial
+		result.Function = function
+	}
+	return result, ok
+}
+
+// finish lets the script print its summary and waits for it to exit.
+func (r *stepRunner) finish() error {
+	r.units.Close()
+	for range r.results {
+	}
+	return r.cmd.Wait()
+}
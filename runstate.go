@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runIDFormat matches the timestamp format used by BACKUP_DIR in lib/utils.sh.
+const runIDFormat = "20060102_150405"
+
+// latestRunName is the symlink in the runs directory pointing at the most
+// recent run.
+const latestRunName = "latest"
+
+// runState describes the state directory of a single installer run.
+type runState struct {
+	ID      string
+	Dir     string
+	Started time.Time
+}
+
+// stateDir returns the installer's state directory, honouring XDG_STATE_HOME.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "dotfiles-installer"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("locating home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "dotfiles-installer"), nil
+}
+
+// runsDir returns the directory holding one subdirectory per run.
+func runsDir() (string, error) {
+	base, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "runs"), nil
+}
+
+// newRunState creates a private state directory for a new run. Runs
+// started within the same second get a suffix, as in 20250101_120000_2, so
+// that they never share a directory.
+func newRunState() (*runState, error) {
+	dir, err := runsDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating runs directory: %w", err)
+	}
+
+	started := time.Now()
+	run := &runState{Started: started}
+	for n := 1; ; n++ {
+		run.ID = started.Format(runIDFormat)
+		if n > 1 {
+			run.ID += fmt.Sprintf("_%d", n)
+		}
+		run.Dir = filepath.Join(dir, run.ID)
+		err := os.Mkdir(run.Dir, 0700)
+		if err == nil {
+			return run, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("creating run directory: %w", err)
+		}
+	}
+}
+
+// linkLatest points runs/latest at the run, replacing the link atomically.
+// The link is a convenience: findRun doesn't need it.
+func (r *runState) linkLatest() error {
+	link := filepath.Join(filepath.Dir(r.Dir), latestRunName)
+	// A crashed run may have left its temporary link behind
+	os.Remove(link + ".new")
+	if err := os.Symlink(r.ID, link+".new"); err != nil {
+		return fmt.Errorf("linking latest run: %w", err)
+	}
+	if err := os.Rename(link+".new", link); err != nil {
+		os.Remove(link + ".new")
+		return fmt.Errorf("linking latest run: %w", err)
+	}
+	return nil
+}
+
+// backupDirName is the directory in a run where the step functions and the
+// Dotfiles step back up the files they replace.
+const backupDirName = "backup"
+
+func (r *runState) backupDir() string {
+	return filepath.Join(r.Dir, backupDirName)
+}
+
+// logsDir holds the full log of the run and one log per step.
+func (r *runState) logsDir() string {
+	return filepath.Join(r.Dir, logsDirName)
+}
+
+// runIDs lists the IDs of all runs, oldest first.
+func runIDs() ([]string, error) {
+	dir, err := runsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading runs directory: %w", err)
+	}
+	// Run IDs are timestamps and ReadDir sorts by name; the latest symlink
+	// is not a directory entry of its own
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
+
+// findRun returns the directory of the run with the given ID, or of the most
+// recent run when id is empty or "latest".
+func findRun(id string) (string, error) {
+	dir, err := runsDir()
+	if err != nil {
+		return "", err
+	}
+
+	if id == "" || id == latestRunName {
+		ids, err := runIDs()
+		if err != nil {
+			return "", err
+		}
+		if len(ids) == 0 {
+			return "", fmt.Errorf("no installer runs found in %s", dir)
+		}
+		id = ids[len(ids)-1]
+	}
+
+	runDir := filepath.Join(dir, id)
+	if info, err := os.Stat(runDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("run %s not found in %s", id, dir)
+	}
+	return runDir, nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// prefetchConcurrency bounds the number of background downloads.
+const prefetchConcurrency = 3
+
+// pacmanDBPath is the system pacman database the prefetch copies from.
+const pacmanDBPath = "/var/lib/pacman"
+
+// prefetchClones lists the repositories step functions clone, and the
+// environment variable telling the step where to find the prefetched copy.
+var prefetchClones = []struct {
+	Step string
+	Name string
+	Repo string
+	Env  string
+}{
+	{Step: "setup_wallpapers", Name: "Wallpapers repository", Repo: "https://github.com/couvbat/wallpapers.git", Env: "WALLPAPERS_PREFETCH_DIR"},
+}
+
+// configSteps only configure the system and install no packages, so they
+// can run in the foreground while downloads are still in progress. Each
+// lists the steps it has to follow when those are part of the plan.
+var configSteps = map[string][]string{
+	"install_node": nil,
+	// Oh My Zsh replaces an existing ~/.zshrc when it is installed
+	"copy_dotfiles": {"setup_zsh"},
+	// The terminal logo is generated with kitty's kitten
+	"setup_fastfetch": {"install_terminal_emulator"},
+}
+
+// foregroundSteps returns the configuration-only steps that can run before
+// the package transactions.
+func (p installPlan) foregroundSteps() []InstallStep {
+	planned := make(map[string]bool)
+	for _, step := range p.Steps {
+		planned[step.Function] = true
+	}
+
+	var steps []InstallStep
+	for _, step := range p.Steps {
+		after, ok := configSteps[step.Function]
+		if !ok {
+			continue
+		}
+		blocked := false
+		for _, function := range after {
+			if planned[function] {
+				blocked = true
+			}
+		}
+		if !blocked {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+type prefetchState string
+
+const (
+	prefetchPending prefetchState = "pending"
+	prefetchRunning prefetchState = "running"
+	prefetchDone    prefetchState = "done"
+	prefetchFailed  prefetchState = "failed"
+)
+
+// prefetchJob is a background download that installs nothing: either the
+// packages of one step fetched into the pacman cache, or a git clone.
+type prefetchJob struct {
+	Name     string
+	Packages []string
+	Repo     string
+	Dest     string
+	State    prefetchState
+	Err      error
+
+	done chan struct{}
+}
+
+// prefetchMsg reports the state of all background downloads.
+type prefetchMsg []prefetchJob
+
+// scheduler runs prefetch jobs on a bounded pool of workers.
+type scheduler struct {
+	dir    string
+	jobs   []*prefetchJob
+	notify func(prefetchMsg)
+	mu     sync.Mutex
+}
+
+// newScheduler prepares the clones and per-step package downloads for a
+// plan. Clones come first since steps wait for them; packages follow in the
+// order the steps run.
+func newScheduler(plan installPlan, dir string, notify func(prefetchMsg)) *scheduler {
+	s := &scheduler{dir: dir, notify: notify}
+
+	for _, clone := range prefetchClones {
+		for _, step := range plan.Steps {
+			if step.Function == clone.Step {
+				s.add(&prefetchJob{
+					Name: clone.Name,
+					Repo: clone.Repo,
+					Dest: filepath.Join(dir, "clones", clone.Step),
+				})
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, step := range plan.Steps {
+		var packages []string
+		for _, pkg := range stepPackages[step.Function].Repo {
+			if !seen[pkg] {
+				seen[pkg] = true
+				packages = append(packages, pkg)
+			}
+		}
+		if len(packages) > 0 {
+			s.add(&prefetchJob{Name: step.Name, Packages: packages})
+		}
+	}
+	return s
+}
+
+func (s *scheduler) add(job *prefetchJob) {
+	job.State = prefetchPending
+	job.done = make(chan struct{})
+	s.jobs = append(s.jobs, job)
+}
+
+// env tells the step functions where prefetched clones will be found. They
+// fall back to cloning themselves when the directory is missing.
+func (s *scheduler) env() []string {
+	var env []string
+	for _, clone := range prefetchClones {
+		env = append(env, fmt.Sprintf("%s=%s", clone.Env, filepath.Join(s.dir, "clones", clone.Step)))
+	}
+	return env
+}
+
+// start launches the workers. It returns immediately. Clones run side by
+// side, but a single pacman downloads the packages, one step after the
+// other: pacman doesn't lock its cache directory, and two downloads of a
+// shared dependency would write to the same .part file.
+func (s *scheduler) start() {
+	var clones, downloads []*prefetchJob
+	for _, job := range s.jobs {
+		if job.Repo != "" {
+			clones = append(clones, job)
+		} else {
+			downloads = append(downloads, job)
+		}
+	}
+	s.run(downloads, min(len(downloads), 1))
+	s.run(clones, min(len(clones), prefetchConcurrency-1))
+	s.report()
+}
+
+// run starts workers taking jobs from a queue of their own.
+func (s *scheduler) run(jobs []*prefetchJob, workers int) {
+	queue := make(chan *prefetchJob, len(jobs))
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	for i := 0; i < workers; i++ {
+		go s.worker(queue)
+	}
+}
+
+// waitAll blocks until every job has finished, successfully or not.
+func (s *scheduler) waitAll() {
+	for _, job := range s.jobs {
+		<-job.done
+	}
+}
+
+func (s *scheduler) worker(queue <-chan *prefetchJob) {
+	// Downloads use their own copy of the sync databases so that they do
+	// not contend for the pacman lock with the steps in the foreground.
+	dbPath := filepath.Join(s.dir, "pacman-db")
+	dbReady := false
+
+	for job := range queue {
+		s.setState(job, prefetchRunning, nil)
+
+		var err error
+		if job.Repo != "" {
+			err = exec.Command("git", "clone", "--quiet", "--depth", "1", job.Repo, job.Dest).Run()
+		} else {
+			refresh := false
+			if !dbReady {
+				err = preparePacmanDB(dbPath)
+				dbReady, refresh = err == nil, true
+			}
+			if err == nil {
+				err = downloadPackages(dbPath, refresh, job.Packages)
+			}
+		}
+
+		if err != nil {
+			s.setState(job, prefetchFailed, err)
+		} else {
+			s.setState(job, prefetchDone, nil)
+		}
+		close(job.done)
+	}
+}
+
+func (s *scheduler) setState(job *prefetchJob, state prefetchState, err error) {
+	s.mu.Lock()
+	job.State = state
+	job.Err = err
+	s.mu.Unlock()
+	s.report()
+}
+
+func (s *scheduler) report() {
+	s.mu.Lock()
+	snapshot := make(prefetchMsg, len(s.jobs))
+	for i, job := range s.jobs {
+		snapshot[i] = *job
+	}
+	s.mu.Unlock()
+	s.notify(snapshot)
+}
+
+// preparePacmanDB creates a private pacman database directory sharing the
+// local database but holding its own copy of the sync databases.
+func preparePacmanDB(dir string) error {
+	syncDir := filepath.Join(dir, "sync")
+	if err := os.MkdirAll(syncDir, 0755); err != nil {
+		return err
+	}
+	if err := os.Symlink(filepath.Join(pacmanDBPath, "local"), filepath.Join(dir, "local")); err != nil {
+		return err
+	}
+
+	databases, err := filepath.Glob(filepath.Join(pacmanDBPath, "sync", "*.db"))
+	if err != nil {
+		return err
+	}
+	for _, db := range databases {
+		if err := copyFile(db, filepath.Join(syncDir, filepath.Base(db))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadPackages fetches packages into the pacman cache without installing
+// them. It relies on the sudo timestamp from the preflight and never prompts.
+func downloadPackages(dbPath string, refresh bool, packages []string) error {
+	operation := "-Sw"
+	if refresh {
+		operation = "-Syw"
+	}
+
+	args := []string{"-n", "pacman", operation, "--needed", "--noconfirm", "--dbpath", dbPath, "--logfile", "/dev/null"}
+	args = append(args, packages...)
+	return exec.Command("sudo", args...).Run()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// view summarises the background downloads for the progress view.
+func (jobs prefetchMsg) view() string {
+	var running []string
+	done, failed := 0, 0
+	for _, job := range jobs {
+		switch job.State {
+		case prefetchRunning:
+			running = append(running, job.Name)
+		case prefetchDone:
+			done++
+		case prefetchFailed:
+			failed++
+		}
+	}
+
+	var result strings.Builder
+	result.WriteString(progressStyle.Render(fmt.Sprintf("Background downloads: %d/%d done, %d/%d running",
+		done+failed, len(jobs), len(running), prefetchConcurrency)))
+	result.WriteString("\n")
+	for _, name := range running {
+		result.WriteString(descriptionStyle.Render("↓ " + name))
+		result.WriteString("\n")
+	}
+	if failed > 0 {
+		result.WriteString(warningStyle.Render(fmt.Sprintf("  %d download(s) failed, packages will be fetched during installation", failed)))
+		result.WriteString("\n")
+	}
+	return result.String()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const installScriptName = "install_selected.sh"
+
+// installScript is a generated install script staged in a private temporary
+// directory so that no other user can replace it before it is executed.
+type installScript struct {
+	dir  string
+	path string
+	// content is what was written and verified, the bytes archived
+	content  []byte
+	checksum string
+}
+
+// stageInstallScript writes content into a fresh 0700 temporary directory
+// and records its SHA-256 checksum.
+func stageInstallScript(content []byte) (*installScript, error) {
+	dir, err := os.MkdirTemp("", "dotfiles-installer-")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("securing temporary directory: %w", err)
+	}
+
+	path := filepath.Join(dir, installScriptName)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0700)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("creating install script: %w", err)
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("writing install script: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("writing install script: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	return &installScript{
+		dir:      dir,
+		path:     path,
+		content:  content,
+		checksum: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// verify re-reads the staged script and checks it still matches the
+// checksum taken when it was written.
+func (s *installScript) verify() error {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("reading install script: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	if got := hex.EncodeToString(sum[:]); got != s.checksum {
+		return fmt.Errorf("install script checksum mismatch: expected %s, got %s", s.checksum, got)
+	}
+	return nil
+}
+
+// archive writes the script as it was staged and verified, with its
+// checksum, into the run directory for auditing and removes the temporary
+// directory. The staged file isn't read back, so the archive always matches
+// the checksum.
+func (s *installScript) archive(run *runState) error {
+	defer os.RemoveAll(s.dir)
+
+	dest := filepath.Join(run.Dir, installScriptName)
+	if err := os.WriteFile(dest, s.content, 0600); err != nil {
+		return fmt.Errorf("archiving install script: %w", err)
+	}
+
+	// Same format as sha256sum so the archive can be checked with `sha256sum -c`.
+	line := fmt.Sprintf("%s  %s\n", s.checksum, installScriptName)
+	if err := os.WriteFile(dest+".sha256", []byte(line), 0600); err != nil {
+		return fmt.Errorf("archiving install script checksum: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// secretRule recognises a likely secret in a config file.
+type secretRule struct {
+	Name string
+	re   *regexp.Regexp
+}
+
+var secretRules = []secretRule{
+	{"private key", regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`)},
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Discord token", regexp.MustCompile(`\b[MNO][A-Za-z0-9_-]{23,25}\.[A-Za-z0-9_-]{6}\.[A-Za-z0-9_-]{27,38}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"OpenAI API key", regexp.MustCompile(`\bsk-(proj-)?[A-Za-z0-9_-]{32,}`)},
+	{"API key or token", regexp.MustCompile(`(?i)["']?\b(api[_-]?key|api[_-]?token|access[_-]?token|auth[_-]?token|secret[_-]?key|client[_-]?secret|password|passwd|token)["']?\s*[:=]\s*["']([^"'\s$]{12,})["']`)},
+}
+
+// secretFinding is a line that looks like it holds a secret.
+type secretFinding struct {
+	Rule string
+	Line int
+}
+
+func (f secretFinding) String() string {
+	return fmt.Sprintf("%s on line %d", f.Rule, f.Line)
+}
+
+// scanSecrets looks for secrets in text content, one finding per line.
+func scanSecrets(content []byte) []secretFinding {
+	if isBinary(content) {
+		return nil
+	}
+	var findings []secretFinding
+	for i, line := range splitLines(content) {
+		if rule := matchSecret(line); rule != "" {
+			findings = append(findings, secretFinding{Rule: rule, Line: i + 1})
+		}
+	}
+	return findings
+}
+
+// matchSecret returns the name of the first rule a line matches, if any.
+func matchSecret(line string) string {
+	for _, rule := range secretRules {
+		if rule.re.MatchString(line) {
+			return rule.Name
+		}
+	}
+	return ""
+}
+
+// Suffixes of the encrypted files of share/dotfiles. They are dropped in
+// $HOME.
+const (
+	ageSuffix = ".age"
+	gpgSuffix = ".gpg"
+)
+
+func isEncrypted(rel string) bool {
+	return strings.HasSuffix(rel, ageSuffix) || strings.HasSuffix(rel, gpgSuffix)
+}
+
+// decryptFile decrypts an age file encrypted with a passphrase, armored or
+// not, or a GPG file through the gpg command.
+func decryptFile(path, passphrase string) ([]byte, error) {
+	if strings.HasSuffix(path, gpgSuffix) {
+		return decryptGPG(path, passphrase)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	in := bufio.NewReader(file)
+	var r io.Reader = in
+	if start, _ := in.Peek(len(armor.Header)); string(start) == armor.Header {
+		r = armor.NewReader(in)
+	}
+	plain, err := age.Decrypt(r, identity)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, fmt.Errorf("wrong passphrase")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(plain)
+}
+
+func decryptGPG(path, passphrase string) ([]byte, error) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		return nil, fmt.Errorf("gpg is not installed")
+	}
+	cmd := exec.Command("gpg", "--batch", "--quiet", "--no-tty", "--pinentry-mode", "loopback", "--passphrase-fd", "0", "--decrypt", path)
+	cmd.Stdin = strings.NewReader(passphrase + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
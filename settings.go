@@ -0,0 +1,670 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ml4wSettingsDir holds the one-value files the ML4W scripts read their
+// settings from.
+const ml4wSettingsDir = ".config/ml4w/settings"
+
+// floatingTerminal runs a command in the terminal of terminal.sh, floating.
+const floatingTerminal = "$(cat ~/.config/ml4w/settings/terminal.sh) --class dotfiles-floating -e "
+
+type settingKind string
+
+const (
+	settingText   settingKind = "text"
+	settingChoice settingKind = "choice"
+	settingPath   settingKind = "path"
+	settingTime   settingKind = "time format"
+	settingBool   settingKind = "boolean"
+	settingNumber settingKind = "number"
+)
+
+// settingOption is a value of a choice, usually an application.
+type settingOption struct {
+	Value string
+	// Step installs the application. Command is looked up on $PATH
+	// otherwise, and defaults to the first word of Value.
+	Step    string
+	Command string
+}
+
+func (o settingOption) command() string {
+	if o.Command != "" {
+		return o.Command
+	}
+	return strings.Fields(o.Value)[0]
+}
+
+// ml4wSetting is a file of ml4wSettingsDir.
+type ml4wSetting struct {
+	File  string
+	Label string
+	Kind  settingKind
+	// Var is the shell variable the file assigns, for files such as
+	// screenshot-folder.sh that are sourced rather than read
+	Var      string
+	Options  []settingOption
+	Optional bool
+}
+
+var ml4wSettings = []ml4wSetting{
+	{File: "terminal.sh", Label: "Terminal", Kind: settingChoice, Options: []settingOption{
+		{Value: "kitty", Step: "install_terminal_emulator"}, {Value: "alacritty"}, {Value: "foot"}, {Value: "wezterm"},
+	}},
+	{File: "browser.sh", Label: "Browser", Kind: settingChoice, Options: []settingOption{
+		{Value: "zen-browser", Step: "install_zen"}, {Value: "firefox", Step: "install_firefox"}, {Value: "chromium", Step: "install_chromium"},
+	}},
+	{File: "editor.sh", Label: "Editor", Kind: settingChoice, Options: []settingOption{
+		{Value: "nvim", Step: "install_neovim"}, {Value: "code", Step: "install_vscode"},
+	}},
+	{File: "filemanager.sh", Label: "File manager", Kind: settingChoice, Options: []settingOption{
+		{Value: "kitty zsh -c spf", Step: "install_superfile", Command: "spf"}, {Value: "nautilus", Step: "install_nautilus"},
+	}},
+	{File: "calculator.sh", Label: "Calculator", Kind: settingChoice, Options: []settingOption{
+		{Value: "gnome-calculator", Step: "install_calculator"}, {Value: "qalculate-gtk"},
+	}},
+	{File: "email.sh", Label: "Email", Kind: settingChoice, Options: []settingOption{
+		{Value: "thunderbird", Step: "install_thunderbird"}, {Value: "evolution"},
+	}},
+	{File: "system-monitor.sh", Label: "System monitor", Kind: settingChoice, Options: []settingOption{
+		{Value: floatingTerminal + "btop", Step: "install_system_monitor", Command: "btop"}, {Value: floatingTerminal + "htop", Command: "htop"},
+	}},
+	{File: "screenshot-editor.sh", Label: "Screenshot editor", Kind: settingChoice, Options: []settingOption{
+		{Value: "pinta", Step: "install_pinta"}, {Value: "gimp", Step: "install_gimp"},
+	}},
+	{File: "aur.sh", Label: "AUR helper", Kind: settingChoice, Options: []settingOption{
+		{Value: "paru", Step: "install_aur_helper"}, {Value: "yay"},
+	}},
+	{File: "wallpaper-engine.sh", Label: "Wallpaper engine", Kind: settingChoice, Options: []settingOption{
+		{Value: "hyprpaper", Step: "install_hyprland_wm"}, {Value: "swww"},
+	}},
+	{File: "screenshot-folder.sh", Label: "Screenshot folder", Kind: settingPath, Var: "screenshot_folder"},
+	{File: "wallpaper-folder.sh", Label: "Wallpaper folder", Kind: settingPath, Var: "wallpaper_folder"},
+	{File: "waybar_timeformat.sh", Label: "Waybar time", Kind: settingTime},
+	{File: "waybar_dateformat.sh", Label: "Waybar date", Kind: settingTime},
+	{File: "waybar_custom_timedateformat.sh", Label: "Waybar date and time", Kind: settingTime, Optional: true},
+	{File: "waybar_timezone.sh", Label: "Waybar timezone", Kind: settingText, Optional: true},
+	{File: "waybar_workspaces.sh", Label: "Waybar workspaces", Kind: settingNumber},
+	{File: "waybar_appmenu.sh", Label: "Waybar app menu", Kind: settingBool},
+	{File: "waybar_backlight.sh", Label: "Waybar backlight", Kind: settingBool},
+	{File: "waybar_chatgpt.sh", Label: "Waybar ChatGPT", Kind: settingBool},
+	{File: "waybar_network.sh", Label: "Waybar network", Kind: settingBool},
+	{File: "waybar_quicklinks.sh", Label: "Waybar quick links", Kind: settingBool},
+	{File: "waybar_screenlock.sh", Label: "Waybar screen lock", Kind: settingBool},
+	{File: "waybar_settings.sh", Label: "Waybar settings", Kind: settingBool},
+	{File: "waybar_systray.sh", Label: "Waybar tray", Kind: settingBool},
+	{File: "waybar_taskbar.sh", Label: "Waybar taskbar", Kind: settingBool},
+	{File: "waybar_toggle.sh", Label: "Waybar toggle", Kind: settingBool},
+	{File: "waybar_window.sh", Label: "Waybar window title", Kind: settingBool},
+	{File: "hypridle_hyprlock_timeout.sh", Label: "Lock after (s)", Kind: settingNumber},
+	{File: "hypridle_dpms_timeout.sh", Label: "Screen off after (s)", Kind: settingNumber},
+	{File: "hypridle_suspend_timeout.sh", Label: "Suspend after (s)", Kind: settingNumber},
+	{File: "wallpaper-automation.sh", Label: "Wallpaper every (s)", Kind: settingNumber},
+	{File: "wallpaper-effect.sh", Label: "Wallpaper effect", Kind: settingText},
+	{File: "hyprshade.sh", Label: "Screen shader", Kind: settingText, Var: "hyprshade_filter"},
+	{File: "blur.sh", Label: "Blur", Kind: settingText},
+	{File: "rofi_bordersize.sh", Label: "Rofi border size", Kind: settingNumber},
+	{File: "emojipicker.sh", Label: "Emoji picker", Kind: settingText},
+	{File: "calendar.sh", Label: "Calendar", Kind: settingText, Optional: true},
+}
+
+// settingField returns the profile variable a settings file is rendered
+// from, for the files that are templates.
+func (p *profile) settingField(file string) *string {
+	switch file {
+	case "terminal.sh":
+		return &p.Terminal
+	case "browser.sh":
+		return &p.Browser
+	case "editor.sh":
+		return &p.Editor
+	}
+	return nil
+}
+
+// settingValue returns the value of a setting saved in the profile, if any.
+func (p profile) settingValue(file string) (string, bool) {
+	if field := p.settingField(file); field != nil {
+		return *field, true
+	}
+	value, ok := p.Settings[file]
+	return value, ok
+}
+
+func (p *profile) setSetting(file, value string) {
+	if field := p.settingField(file); field != nil {
+		*field = value
+		return
+	}
+	if p.Settings == nil {
+		p.Settings = make(map[string]string)
+	}
+	p.Settings[file] = value
+}
+
+// applySetting replaces the content of a shipped settings file with the
+// value saved in the profile.
+func (p profile) applySetting(file *dotfile) error {
+	if path.Dir(file.Path) != ml4wSettingsDir {
+		return nil
+	}
+	value, ok := p.Settings[path.Base(file.Path)]
+	if !ok {
+		return nil
+	}
+	for _, setting := range ml4wSettings {
+		if setting.File == path.Base(file.Path) {
+			base, err := file.content()
+			if err != nil {
+				return err
+			}
+			file.Rendered = setting.render(base, value)
+		}
+	}
+	return nil
+}
+
+// read returns the value a settings file holds.
+func (s ml4wSetting) read(content []byte) string {
+	if s.Var == "" {
+		return strings.TrimSpace(string(content))
+	}
+	for _, line := range splitLines(content) {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), s.Var+"="); ok {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// render returns base with the value of the setting, keeping the comments,
+// quotes and final newline of base.
+func (s ml4wSetting) render(base []byte, value string) []byte {
+	newline := strings.HasSuffix(string(base), "\n")
+	if s.Var == "" {
+		if newline {
+			value += "\n"
+		}
+		return []byte(value)
+	}
+
+	lines := splitLines(base)
+	assignment := s.Var + "=" + value
+	found := false
+	for i, line := range lines {
+		if old, ok := strings.CutPrefix(strings.TrimSpace(line), s.Var+"="); ok {
+			if strings.HasPrefix(old, `"`) {
+				assignment = s.Var + `="` + value + `"`
+			}
+			lines[i], found = assignment, true
+		}
+	}
+	if !found {
+		lines = append(lines, s.Var+`="`+value+`"`)
+	}
+	content := strings.Join(lines, "\n")
+	if newline || !found {
+		content += "\n"
+	}
+	return []byte(content)
+}
+
+// strftimeLayouts maps the strftime directives Waybar formats use to Go
+// time layouts, for the preview.
+var strftimeLayouts = map[byte]string{
+	'H': "15", 'I': "03", 'M': "04", 'S': "05", 'p': "PM",
+	'a': "Mon", 'A': "Monday", 'b': "Jan", 'B': "January", 'h': "Jan",
+	'd': "02", 'e': "_2", 'm': "01", 'y': "06", 'Y': "2006", 'Z': "MST", 'z': "-0700", 'j': "002",
+}
+
+// formatStrftime formats t with a strftime format, and fails on the
+// directives it doesn't know.
+func formatStrftime(format string, t time.Time) (string, error) {
+	var result strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			result.WriteByte(format[i])
+			continue
+		}
+		if i+1 == len(format) {
+			return "", fmt.Errorf("%q ends with %%", format)
+		}
+		i++
+		switch layout, ok := strftimeLayouts[format[i]]; {
+		case format[i] == '%':
+			result.WriteByte('%')
+		case ok:
+			result.WriteString(t.Format(layout))
+		default:
+			return "", fmt.Errorf("unknown directive %%%c", format[i])
+		}
+	}
+	return result.String(), nil
+}
+
+// validate checks a value typed in for the setting.
+func (s ml4wSetting) validate(value string) error {
+	if value == "" {
+		if s.Optional {
+			return nil
+		}
+		return fmt.Errorf("%s can't be empty", s.Label)
+	}
+	switch s.Kind {
+	case settingNumber:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("%s must be a whole number", s.Label)
+		}
+	case settingTime:
+		if _, err := formatStrftime(value, time.Now()); err != nil {
+			return fmt.Errorf("%s: %w", s.Label, err)
+		}
+	case settingBool:
+		if value != "True" && value != "False" {
+			return fmt.Errorf("%s must be True or False", s.Label)
+		}
+	case settingPath:
+		if !strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "~") && !strings.HasPrefix(value, "$HOME") {
+			return fmt.Errorf("%s must start with /, ~ or $HOME", s.Label)
+		}
+	}
+	return nil
+}
+
+// selectedOrInstalled returns whether the application of an option is
+// selected for installation or already on $PATH.
+func selectedOrInstalled(selected map[string]bool) func(settingOption) bool {
+	return func(option settingOption) bool {
+		if option.Step != "" && selected[option.Step] {
+			return true
+		}
+		_, err := exec.LookPath(option.command())
+		return err == nil
+	}
+}
+
+// settingsForm edits the ML4W settings. Values are read from $HOME, where
+// the ML4W settings app may have changed them, then from the profile and
+// the checkout. Saving keeps them in the profile, so that deploying the
+// dotfiles writes them. The settings command also writes them to $HOME
+// right away.
+type settingsForm struct {
+	source   string
+	home     string
+	profile  profile
+	settings []ml4wSetting
+	values   []string
+	// shipped are the values of the checkout
+	shipped []string
+	// suggested explains a value picked because the current one's
+	// application isn't there
+	suggested []string
+	available func(settingOption) bool
+	// deploy writes the settings files into $HOME. Within the installer the
+	// Dotfiles step writes them instead.
+	deploy bool
+
+	cursor int
+	offset int
+	// editing is set while the value under the cursor is typed in
+	editing bool
+	input   string
+	message string
+	err     error
+}
+
+func newSettingsForm(source, home string, prof profile, available func(settingOption) bool, deploy bool) settingsForm {
+	f := settingsForm{source: source, home: home, profile: prof, available: available, deploy: deploy}
+	for _, setting := range ml4wSettings {
+		shipped, err := shippedSetting(source, setting.File, defaultProfile())
+		if err != nil {
+			continue
+		}
+
+		value := setting.read(shipped)
+		f.shipped = append(f.shipped, value)
+		if saved, ok := prof.settingValue(setting.File); ok {
+			value = saved
+		}
+		if current, err := os.ReadFile(filepath.Join(home, ml4wSettingsDir, setting.File)); err == nil {
+			value = setting.read(current)
+		}
+
+		suggestion := ""
+		if option, ok := setting.option(value); (ok || value == "") && (!ok || !available(option)) {
+			for _, candidate := range setting.Options {
+				if available(candidate) {
+					if value == "" {
+						suggestion = "was empty"
+					} else {
+						suggestion = fmt.Sprintf("%s isn't installed or selected", option.command())
+					}
+					value = candidate.Value
+					break
+				}
+			}
+		}
+		f.settings = append(f.settings, setting)
+		f.values = append(f.values, value)
+		f.suggested = append(f.suggested, suggestion)
+	}
+	return f
+}
+
+// shippedSetting returns a settings file of the checkout, rendered with the
+// profile if it is a template.
+func shippedSetting(source, file string, prof profile) ([]byte, error) {
+	name := filepath.Join(source, ml4wSettingsDir, file)
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		if _, statErr := os.Stat(name + templateSuffix); statErr == nil {
+			return renderTemplate(source, name+templateSuffix, prof)
+		}
+	}
+	return data, err
+}
+
+// option returns the option of a choice with the value.
+func (s ml4wSetting) option(value string) (settingOption, bool) {
+	for _, option := range s.Options {
+		if option.Value == value {
+			return option, true
+		}
+	}
+	return settingOption{}, false
+}
+
+// update handles keys on the settings form. It returns done when the form
+// is left, after saving.
+func (f settingsForm) update(msg tea.KeyMsg, page int) (settingsForm, bool, tea.Cmd) {
+	if f.editing {
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			return f, true, tea.Quit
+		case tea.KeyEsc:
+			f.editing, f.err = false, nil
+		case tea.KeyEnter:
+			value := strings.TrimSpace(f.input)
+			if f.err = f.settings[f.cursor].validate(value); f.err == nil {
+				f.values[f.cursor], f.suggested[f.cursor] = value, ""
+				f.editing = false
+			}
+		case tea.KeyBackspace:
+			if runes := []rune(f.input); len(runes) > 0 {
+				f.input = string(runes[:len(runes)-1])
+			}
+		case tea.KeySpace:
+			f.input += " "
+		case tea.KeyRunes:
+			f.input += string(msg.Runes)
+		}
+		return f, false, nil
+	}
+
+	if len(f.settings) == 0 {
+		return f, true, nil
+	}
+	setting := f.settings[f.cursor]
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return f, true, tea.Quit
+	case "up", "k":
+		f.cursor = max(f.cursor-1, 0)
+	case "down", "j":
+		f.cursor = min(f.cursor+1, len(f.settings)-1)
+	case "pgup":
+		f.cursor = max(f.cursor-page, 0)
+	case "pgdown":
+		f.cursor = min(f.cursor+page, len(f.settings)-1)
+	case "left", "h", "right", "l", " ", "space":
+		switch setting.Kind {
+		case settingBool:
+			if f.values[f.cursor] == "True" {
+				f.values[f.cursor] = "False"
+			} else {
+				f.values[f.cursor] = "True"
+			}
+		case settingChoice:
+			// A value typed in is before the first option
+			i := -1
+			for j, option := range setting.Options {
+				if option.Value == f.values[f.cursor] {
+					i = j
+				}
+			}
+			if msg.String() == "left" || msg.String() == "h" {
+				if i <= 0 {
+					i = len(setting.Options)
+				}
+				i--
+			} else {
+				i = (i + 1) % len(setting.Options)
+			}
+			f.values[f.cursor] = setting.Options[i].Value
+		}
+		f.suggested[f.cursor] = ""
+	case "enter":
+		if setting.Kind != settingBool {
+			f.editing, f.input, f.err = true, f.values[f.cursor], nil
+		}
+	case "s":
+		f.message, f.err = f.save()
+	case "esc":
+		if f.message, f.err = f.save(); f.err == nil {
+			return f, true, nil
+		}
+	}
+	if f.cursor < f.offset {
+		f.offset = f.cursor
+	} else if f.cursor >= f.offset+page {
+		f.offset = f.cursor - page + 1
+	}
+	return f, false, nil
+}
+
+// save keeps the values that differ from the checkout in the profile, and
+// writes the settings files of $HOME if deploying and ML4W's settings are
+// there.
+func (f *settingsForm) save() (string, error) {
+	prof := f.profile
+	prof.Settings = make(map[string]string)
+	for i, setting := range f.settings {
+		if prof.settingField(setting.File) != nil || f.values[i] != f.shipped[i] {
+			prof.setSetting(setting.File, f.values[i])
+		}
+	}
+	if len(prof.Settings) == 0 {
+		prof.Settings = nil
+	}
+	if err := prof.save(); err != nil {
+		return "", err
+	}
+	f.profile = prof
+
+	if _, err := os.Stat(filepath.Join(f.home, ml4wSettingsDir)); err != nil || !f.deploy {
+		return "Saved to the profile, the settings are written with the dotfiles", nil
+	}
+	written := 0
+	for i, setting := range f.settings {
+		target := filepath.Join(f.home, ml4wSettingsDir, setting.File)
+		base, err := os.ReadFile(target)
+		if os.IsNotExist(err) {
+			base, err = shippedSetting(f.source, setting.File, prof)
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, statErr := os.Stat(target); statErr == nil && setting.read(base) == f.values[i] {
+			continue
+		}
+		if err := writeFileAtomic(target, setting.render(base, f.values[i]), 0644); err != nil {
+			return "", err
+		}
+		written++
+	}
+	return fmt.Sprintf("✅ Saved, %d file(s) written to ~/%s", written, ml4wSettingsDir), nil
+}
+
+func (f settingsForm) view(page int) string {
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("⚙️  ML4W Settings"))
+	result.WriteString("\n")
+	result.WriteString(descriptionStyle.Render("The files of ~/" + ml4wSettingsDir + " the ML4W scripts read."))
+	result.WriteString("\n\n")
+
+	if len(f.settings) == 0 {
+		result.WriteString(fmt.Sprintf("No settings found in %s.\n\nPress any key to go back...", filepath.Join(f.source, ml4wSettingsDir)))
+		return result.String()
+	}
+
+	end := min(f.offset+page, len(f.settings))
+	for i := f.offset; i < end; i++ {
+		setting, value := f.settings[i], f.values[i]
+		note := ""
+		switch setting.Kind {
+		case settingBool:
+			if value == "True" {
+				value = "☑ " + value
+			} else {
+				value = "☐ " + value
+			}
+		case settingChoice:
+			if option, ok := setting.option(value); ok && !f.available(option) {
+				note = "not installed"
+			}
+			value = strings.TrimPrefix(value, floatingTerminal) + "  ◂▸"
+		case settingTime:
+			if preview, err := formatStrftime(value, time.Now()); err == nil && value != "" {
+				note = "e.g. " + preview
+			}
+		}
+		if f.suggested[i] != "" {
+			note = "suggested, " + f.suggested[i]
+		}
+		if f.editing && i == f.cursor {
+			value, note = f.input+"█", string(setting.Kind)
+		}
+
+		line := fmt.Sprintf("%-22s %-28s %s", setting.Label, value, note)
+		if i == f.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else if f.suggested[i] != "" {
+			result.WriteString(warningStyle.Render("  " + line))
+		} else {
+			result.WriteString(unselectedStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	if f.err != nil {
+		result.WriteString("\n")
+		result.WriteString(errorStyle.Render(f.err.Error()))
+		result.WriteString("\n")
+	} else if f.message != "" {
+		result.WriteString("\n")
+		result.WriteString(successStyle.Render(f.message))
+		result.WriteString("\n")
+	}
+
+	if f.editing {
+		result.WriteString("\nType the value, ENTER to keep it, ESC to cancel")
+	} else {
+		result.WriteString(fmt.Sprintf("\n%s: %s. Use ↑↓ to navigate, ←→ or SPACE to change, ENTER to type a value, 's' to save, ESC to save and go back",
+			f.settings[f.cursor].File, f.settings[f.cursor].Kind))
+	}
+	return result.String()
+}
+
+// updateSettingsForm handles keys on the settings screen of the dotfiles
+// review, which rescans the dotfiles with the saved settings.
+func (m model) updateSettingsForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	form, done, cmd := m.settings.update(msg, m.listHeight())
+	m.settings = form
+	if done && cmd == nil {
+		m.editingSettings = false
+		m.review.profile.Settings = form.profile.Settings
+		for _, setting := range form.settings {
+			if field := m.review.profile.settingField(setting.File); field != nil {
+				*field = *form.profile.settingField(setting.File)
+			}
+		}
+		m.review = m.review.rescan(m.review.mode)
+	}
+	return m, cmd
+}
+
+// settingsModel is the settings form on its own.
+type settingsModel struct {
+	form   settingsForm
+	height int
+}
+
+func (m settingsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m settingsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		form, done, _ := m.form.update(msg, m.listHeight())
+		m.form = form
+		if done {
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m settingsModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-10, 5)
+}
+
+func (m settingsModel) View() string {
+	return m.form.view(m.listHeight())
+}
+
+// settingsCommand implements `dotfiles-installer settings`. The defaults
+// follow the applications installed.
+func settingsCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: dotfiles-installer settings")
+	}
+
+	source, err := filepath.Abs(dotfilesSourceDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	prof, err := loadProfile()
+	if err != nil {
+		return err
+	}
+
+	form := newSettingsForm(source, home, prof, selectedOrInstalled(nil), true)
+	p := tea.NewProgram(settingsModel{form: form}, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
@@ -1 +0,0 @@
-zen-browser
\ No newline at end of file
@@ -1 +0,0 @@
-nvim
\ No newline at end of file
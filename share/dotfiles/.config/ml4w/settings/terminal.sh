@@ -1,2 +0,0 @@
-kitty
-
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// driftStatus is how a file in $HOME differs from the checkout.
+type driftStatus string
+
+const (
+	driftModified    driftStatus = "modified"
+	driftMissing     driftStatus = "missing"
+	driftExtra       driftStatus = "extra"
+	driftPermissions driftStatus = "permissions changed"
+)
+
+// driftEntry is a file in $HOME that differs from share/dotfiles.
+type driftEntry struct {
+	Path   string      `json:"path"`
+	Status driftStatus `json:"status"`
+	// SHA256 and Mode describe the file in the checkout, HomeSHA256 and
+	// HomeMode the one in $HOME
+	SHA256     string `json:"sha256,omitempty"`
+	HomeSHA256 string `json:"home_sha256,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	HomeMode   string `json:"home_mode,omitempty"`
+}
+
+// driftReport is the result of comparing $HOME with the checkout.
+type driftReport struct {
+	Source    string       `json:"source"`
+	Home      string       `json:"home"`
+	Unchanged int          `json:"unchanged"`
+	Files     []driftEntry `json:"files"`
+	// Locked are the encrypted files, which are not compared
+	Locked []string `json:"locked,omitempty"`
+
+	// rendered holds the output of the templates by path
+	rendered map[string][]byte
+}
+
+// checkDrift compares every file of the checkout with its counterpart in
+// home by content hash and permissions. Files the checkout doesn't have are
+// reported as extra inside the application directories it ships, such as
+// .config/hypr, but not in $HOME or .config themselves. Templates and
+// merged files are compared by their output, and .dotfilesignore applies
+// on both sides. Encrypted files are left out, as there is no passphrase.
+func checkDrift(source, home string, prof profile) (driftReport, error) {
+	report := driftReport{Source: source, Home: home, Files: []driftEntry{}, rendered: make(map[string][]byte)}
+	tree, err := loadDotfilesTree(source, prof)
+	if err != nil {
+		return report, err
+	}
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+
+	err = tree.walk(func(rel string, entry fs.DirEntry) error {
+		if entry.IsDir() {
+			dirs[rel] = true
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		file, err := tree.dotfile(home, rel, info.Mode().Perm())
+		files[file.Path] = true
+		if errors.Is(err, errLocked) {
+			report.Locked = append(report.Locked, file.Path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if file.Rendered != nil {
+			report.rendered[file.Path] = file.Rendered
+		}
+		drift, err := compareDrift(file)
+		if err != nil {
+			return err
+		}
+		if drift == nil {
+			report.Unchanged++
+		} else {
+			report.Files = append(report.Files, *drift)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("scanning %s: %w", source, err)
+	}
+
+	for dir := range dirs {
+		if strings.Count(dir, "/") != 1 {
+			continue
+		}
+		root := filepath.Join(home, dir)
+		// A linked directory has exactly the files of the checkout
+		err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			rel, err := filepath.Rel(home, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if tree.ignore.ignored(rel, entry.IsDir()) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// Skip the files of the checkout and subdirectories linked into it
+			if !entry.IsDir() && !files[rel] && !dirs[rel] {
+				report.Files = append(report.Files, driftEntry{Path: rel, Status: driftExtra})
+			}
+			return nil
+		})
+		if err != nil {
+			return report, fmt.Errorf("scanning %s: %w", root, err)
+		}
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path })
+	return report, nil
+}
+
+// compareDrift compares a file of the checkout with its deployed copy and
+// returns nil when they match. Links into the checkout always match.
+func compareDrift(file dotfile) (*driftEntry, error) {
+	want, err := file.content()
+	if err != nil {
+		return nil, err
+	}
+	drift := &driftEntry{Path: file.Path, SHA256: sha256Hex(want)}
+
+	info, err := os.Stat(file.Target)
+	if os.IsNotExist(err) {
+		drift.Status = driftMissing
+		return drift, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		drift.Status = driftModified
+		return drift, nil
+	}
+	have, err := os.ReadFile(file.Target)
+	if err != nil {
+		return nil, err
+	}
+	drift.HomeSHA256 = sha256Hex(have)
+
+	// Group and world write permissions depend on the umask of the clone
+	if mode := file.deployedMode(); info.Mode().Perm()&0755 != mode&0755 {
+		drift.Status = driftPermissions
+		drift.Mode = fmt.Sprintf("%04o", mode)
+		drift.HomeMode = fmt.Sprintf("%04o", info.Mode().Perm())
+	}
+	if drift.HomeSHA256 != drift.SHA256 {
+		drift.Status = driftModified
+	}
+	if drift.Status == "" {
+		return nil, nil
+	}
+	return drift, nil
+}
+
+// statusModel shows the drift as a tree.
+type statusModel struct {
+	report   driftReport
+	expanded map[string]bool
+	cursor   int
+	offset   int
+	height   int
+	err      error
+
+	// diff is the diff being viewed, if any
+	diff       []string
+	diffOffset int
+}
+
+func newStatusModel(report driftReport) statusModel {
+	m := statusModel{report: report, expanded: map[string]bool{"": true}}
+	// Drift is usually small, so everything starts out expanded
+	for _, file := range report.Files {
+		for dir := path.Dir(file.Path); dir != "."; dir = path.Dir(dir) {
+			m.expanded[dir+"/"] = true
+		}
+	}
+	return m
+}
+
+func (m statusModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m statusModel) rows() []reviewRow {
+	paths := make([]string, len(m.report.Files))
+	for i, file := range m.report.Files {
+		paths[i] = file.Path
+	}
+	return treeRows(paths, m.expanded)
+}
+
+// fileDiff shows how the file in $HOME differs from the checkout.
+func (m statusModel) fileDiff(file driftEntry) ([]string, error) {
+	want, ok := m.report.rendered[file.Path]
+	if !ok {
+		var err error
+		if want, err = os.ReadFile(filepath.Join(m.report.Source, file.Path)); err != nil {
+			return nil, err
+		}
+	}
+	target := filepath.Join(m.report.Home, file.Path)
+	have, err := os.ReadFile(target)
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(want) || isBinary(have) {
+		return []string{fmt.Sprintf("Binary files %s and %s differ", file.Path, target)}, nil
+	}
+	return splitLines([]byte(unifiedDiff(filepath.Join(m.report.Source, file.Path), target, splitLines(want), splitLines(have)))), nil
+}
+
+func (m statusModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		page := m.listHeight()
+		if m.diff != nil {
+			switch msg.String() {
+			case "ctrl+c":
+				return m, tea.Quit
+			case "esc", "q", "d":
+				m.diff, m.diffOffset = nil, 0
+			case "up", "k":
+				m.diffOffset = max(m.diffOffset-1, 0)
+			case "down", "j":
+				m.diffOffset = max(min(m.diffOffset+1, len(m.diff)-page), 0)
+			case "pgup":
+				m.diffOffset = max(m.diffOffset-page, 0)
+			case "pgdown":
+				m.diffOffset = max(min(m.diffOffset+page, len(m.diff)-page), 0)
+			}
+			return m, nil
+		}
+
+		rows := m.rows()
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+		}
+		if len(rows) == 0 {
+			return m, nil
+		}
+		row := rows[m.cursor]
+
+		switch msg.String() {
+		case "up", "k":
+			m.cursor = max(m.cursor-1, 0)
+		case "down", "j":
+			m.cursor = min(m.cursor+1, len(rows)-1)
+		case "pgup":
+			m.cursor = max(m.cursor-page, 0)
+		case "pgdown":
+			m.cursor = min(m.cursor+page, len(rows)-1)
+		case "right", "l", " ", "space":
+			if row.File < 0 {
+				m.expanded[row.Dir] = !m.expanded[row.Dir] || msg.String() == "right" || msg.String() == "l"
+			}
+		case "left", "h":
+			if row.File < 0 {
+				m.expanded[row.Dir] = false
+			}
+		case "d":
+			if row.File >= 0 && m.report.Files[row.File].Status == driftModified {
+				m.diff, m.err = m.fileDiff(m.report.Files[row.File])
+				m.diffOffset = 0
+			}
+		}
+
+		m.cursor = min(m.cursor, len(m.rows())-1)
+		if m.cursor < m.offset {
+			m.offset = m.cursor
+		} else if m.cursor >= m.offset+page {
+			m.offset = m.cursor - page + 1
+		}
+	}
+	return m, nil
+}
+
+func (m statusModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-10, 5)
+}
+
+func (m statusModel) View() string {
+	var result strings.Builder
+
+	if m.diff != nil {
+		result.WriteString(titleStyle.Render("🔍 Local changes to " + m.report.Files[m.rows()[m.cursor].File].Path))
+		result.WriteString("\n")
+		end := min(m.diffOffset+m.listHeight(), len(m.diff))
+		for _, line := range m.diff[m.diffOffset:end] {
+			result.WriteString(renderDiffLine(line))
+			result.WriteString("\n")
+		}
+		result.WriteString(fmt.Sprintf("\nLines %d-%d of %d. Use ↑↓/PgUp/PgDn to scroll, ESC to go back", m.diffOffset+1, end, len(m.diff)))
+		return result.String()
+	}
+
+	result.WriteString(titleStyle.Render("🧭 Dotfiles Status"))
+	result.WriteString("\n")
+
+	counts := make(map[driftStatus]int)
+	for _, file := range m.report.Files {
+		counts[file.Status]++
+	}
+	result.WriteString(fmt.Sprintf("%d modified, %d missing, %d extra, %d permissions changed, %d unchanged\n\n",
+		counts[driftModified], counts[driftMissing], counts[driftExtra], counts[driftPermissions], m.report.Unchanged))
+	if len(m.report.Locked) > 0 {
+		result.WriteString(descriptionStyle.Render(fmt.Sprintf("🔒 %d encrypted file(s) not compared", len(m.report.Locked))))
+		result.WriteString("\n\n")
+	}
+
+	rows := m.rows()
+	if len(rows) == 0 {
+		result.WriteString(successStyle.Render(fmt.Sprintf("✅ %s matches %s", m.report.Home, m.report.Source)))
+		result.WriteString("\n")
+	}
+	end := min(m.offset+m.listHeight(), len(rows))
+	for i := m.offset; i < end; i++ {
+		line := strings.Repeat("  ", rows[i].Depth) + m.rowLabel(rows[i])
+		if i == m.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else {
+			result.WriteString(m.rowStyle(rows[i]).Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	if m.err != nil {
+		result.WriteString("\n")
+		result.WriteString(errorStyle.Render(m.err.Error()))
+		result.WriteString("\n")
+	}
+
+	result.WriteString("\nUse ↑↓ to navigate, →← to expand or fold, d to show local changes, 'q' to quit")
+	return result.String()
+}
+
+func (m statusModel) rowLabel(row reviewRow) string {
+	if row.File >= 0 {
+		file := m.report.Files[row.File]
+		label := fmt.Sprintf("%s  %s", path.Base(file.Path), file.Status)
+		if file.HomeMode != "" {
+			label += fmt.Sprintf(" (%s, expected %s)", file.HomeMode, file.Mode)
+		}
+		return label
+	}
+
+	marker := "▸"
+	if m.expanded[row.Dir] {
+		marker = "▾"
+	}
+	n := 0
+	for _, file := range m.report.Files {
+		if strings.HasPrefix(file.Path, row.Dir) {
+			n++
+		}
+	}
+	return fmt.Sprintf("%s %s  %d changed", marker, path.Base(row.Dir)+"/", n)
+}
+
+func (m statusModel) rowStyle(row reviewRow) lipgloss.Style {
+	if row.File < 0 {
+		return categoryStyle.UnsetMarginTop().UnsetMarginLeft()
+	}
+	switch m.report.Files[row.File].Status {
+	case driftModified, driftMissing:
+		return warningStyle
+	case driftExtra:
+		return successStyle
+	default:
+		return unselectedStyle
+	}
+}
+
+// statusCommand implements `dotfiles-installer status [--json]`.
+func statusCommand(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the drift as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("usage: dotfiles-installer status [--json]")
+	}
+
+	source, err := filepath.Abs(dotfilesSourceDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	prof, err := loadProfile()
+	if err != nil {
+		return err
+	}
+	report, err := checkDrift(source, home, prof)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	p := tea.NewProgram(newStatusModel(report), tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// hyprConfDir holds the parts of the Hyprland config, with the variant
+// groups below it.
+const hyprConfDir = ".config/hypr/conf"
+
+// variantGroup is a directory of .config/hypr/conf holding alternative
+// versions of a part of the Hyprland config. Its selector file sources the
+// chosen one.
+type variantGroup struct {
+	Dir      string
+	Selector string
+	Label    string
+	// Default is what the selector sourced before it was templated. The
+	// monitors and keybindings are the Monitor and Keyboard of the profile.
+	Default string
+}
+
+var variantGroups = []variantGroup{
+	{Dir: "monitors", Selector: "monitor.conf", Label: "Monitors"},
+	{Dir: "keybindings", Selector: "keybinding.conf", Label: "Keybindings"},
+	{Dir: "animations", Selector: "animation.conf", Label: "Animations", Default: "default"},
+	{Dir: "decorations", Selector: "decoration.conf", Label: "Decorations", Default: "default"},
+	{Dir: "windows", Selector: "window.conf", Label: "Windows", Default: "default"},
+	{Dir: "layouts", Selector: "layout.conf", Label: "Layouts", Default: "laptop"},
+	{Dir: "environments", Selector: "environment.conf", Label: "Environment", Default: "nvidia"},
+	{Dir: "workspaces", Selector: "workspace.conf", Label: "Workspaces", Default: "default"},
+	{Dir: "windowrules", Selector: "windowrule.conf", Label: "Window rules", Default: "default"},
+}
+
+// variantOption is a file of a variant group.
+type variantOption struct {
+	// Name is the file name without .conf, as stored in the profile
+	Name  string
+	Title string
+}
+
+// variantNameHeader matches the `# name: "Default"` comment of the variant
+// files. Some of them omit the colon.
+var variantNameHeader = regexp.MustCompile(`(?m)^#\s*name:?\s*"?([^"\n]*?)"?\s*$`)
+
+// variantOptions lists the files of a variant group in the checkout, titled
+// by their name header.
+func variantOptions(source string, group variantGroup) ([]variantOption, error) {
+	var options []variantOption
+	for _, name := range presets(source, hyprConfDir+"/"+group.Dir) {
+		data, err := os.ReadFile(filepath.Join(source, hyprConfDir, group.Dir, name+".conf"))
+		if err != nil {
+			return nil, err
+		}
+		option := variantOption{Name: name, Title: name}
+		if match := variantNameHeader.FindSubmatch(data); match != nil && len(match[1]) > 0 {
+			option.Title = string(match[1])
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+// detectVariant returns the variant the selector file in home sources, or
+// "" when it is missing, empty or sources something else.
+func detectVariant(home string, group variantGroup) string {
+	data, err := os.ReadFile(filepath.Join(home, hyprConfDir, group.Selector))
+	if err != nil {
+		return ""
+	}
+	for _, match := range hyprSourceLine.FindAllSubmatch(data, -1) {
+		rel := string(match[1])
+		if path.Dir(rel) == hyprConfDir+"/"+group.Dir && strings.HasSuffix(rel, ".conf") {
+			return strings.TrimSuffix(path.Base(rel), ".conf")
+		}
+	}
+	return ""
+}
+
+// variantsModel picks the variant of every group. A choice is saved to the
+// profile, so that deploying the dotfiles keeps it, and written to the
+// selector file in $HOME right away.
+type variantsModel struct {
+	source  string
+	home    string
+	profile profile
+	groups  []variantGroup
+	options [][]variantOption
+	// current is the variant of each group detected in $HOME
+	current []string
+
+	cursor int
+	// picking is set while the options of the group under the cursor are
+	// listed
+	picking bool
+	choice  int
+	offset  int
+	height  int
+	message string
+	err     error
+}
+
+func newVariantsModel(source, home string, prof profile) (variantsModel, error) {
+	m := variantsModel{source: source, home: home, profile: prof}
+	m.profile.Variants = maps.Clone(prof.Variants)
+	for _, group := range variantGroups {
+		options, err := variantOptions(source, group)
+		if err != nil {
+			return m, err
+		}
+		if len(options) == 0 {
+			continue
+		}
+		current := detectVariant(home, group)
+		// What is in $HOME wins, e.g. after a change in the ML4W settings app
+		if indexOfVariant(options, current) >= 0 {
+			m.profile.setVariant(group.Dir, current)
+		}
+		m.groups = append(m.groups, group)
+		m.options = append(m.options, options)
+		m.current = append(m.current, current)
+	}
+	return m, nil
+}
+
+func indexOfVariant(options []variantOption, name string) int {
+	for i, option := range options {
+		if option.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m variantsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m variantsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if len(m.groups) == 0 {
+			return m, tea.Quit
+		}
+
+		if !m.picking {
+			switch msg.String() {
+			case "q", "esc":
+				return m, tea.Quit
+			case "up", "k":
+				m.cursor = max(m.cursor-1, 0)
+			case "down", "j":
+				m.cursor = min(m.cursor+1, len(m.groups)-1)
+			case "enter", "right", "l":
+				m.picking, m.offset = true, 0
+				m.choice = max(indexOfVariant(m.options[m.cursor], m.profile.Variant(m.groups[m.cursor].Dir)), 0)
+				m.message, m.err = "", nil
+			}
+			return m, nil
+		}
+
+		options := m.options[m.cursor]
+		page := m.listHeight()
+		switch msg.String() {
+		case "q":
+			return m, tea.Quit
+		case "esc", "left", "h":
+			m.picking = false
+		case "up", "k":
+			m.choice = max(m.choice-1, 0)
+		case "down", "j":
+			m.choice = min(m.choice+1, len(options)-1)
+		case "pgup":
+			m.choice = max(m.choice-page, 0)
+		case "pgdown":
+			m.choice = min(m.choice+page, len(options)-1)
+		case "enter":
+			m.message, m.err = m.choose(m.groups[m.cursor], options[m.choice].Name)
+			if m.err == nil {
+				m.picking = false
+			}
+		}
+		if m.choice < m.offset {
+			m.offset = m.choice
+		} else if m.choice >= m.offset+page {
+			m.offset = m.choice - page + 1
+		}
+	}
+	return m, nil
+}
+
+// choose saves a variant to the profile and renders the selector file into
+// $HOME, if Hyprland's config is there.
+func (m *variantsModel) choose(group variantGroup, name string) (string, error) {
+	prof := m.profile
+	prof.Variants = maps.Clone(m.profile.Variants)
+	prof.setVariant(group.Dir, name)
+	if err := prof.validate(m.source); err != nil {
+		return "", err
+	}
+	if err := prof.save(); err != nil {
+		return "", err
+	}
+	m.profile = prof
+
+	written, err := writeRendered(m.source, m.home, prof, hyprConfDir+"/"+group.Selector)
+	if err != nil || !written {
+		return "Saved to the profile, the selector is written with the dotfiles", err
+	}
+	m.current[m.cursor] = name
+	return "✅ Wrote ~/" + hyprConfDir + "/" + group.Selector, nil
+}
+
+// writeRendered renders a template of the Hyprland config, such as a
+// selector file, into home with the profile. It writes nothing and returns
+// false when the Hyprland config isn't deployed there.
+func writeRendered(source, home string, prof profile, rel string) (bool, error) {
+	content, err := renderTemplate(source, filepath.Join(source, rel+templateSuffix), prof)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(filepath.Join(home, hyprConfDir)); err != nil {
+		return false, nil
+	}
+	return true, writeFileAtomic(filepath.Join(home, rel), content, 0644)
+}
+
+func (m variantsModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-10, 5)
+}
+
+func (m variantsModel) View() string {
+	var result strings.Builder
+
+	if len(m.groups) == 0 {
+		result.WriteString(titleStyle.Render("🎨 Hyprland Variants"))
+		result.WriteString("\n")
+		result.WriteString(fmt.Sprintf("No variant groups found in %s.\n\nPress any key to exit...", filepath.Join(m.source, hyprConfDir)))
+		return result.String()
+	}
+
+	if m.picking {
+		group := m.groups[m.cursor]
+		options := m.options[m.cursor]
+		result.WriteString(titleStyle.Render("🎨 " + group.Label))
+		result.WriteString("\n")
+		result.WriteString(descriptionStyle.Render("Sourced by ~/" + hyprConfDir + "/" + group.Selector))
+		result.WriteString("\n\n")
+
+		end := min(m.offset+m.listHeight(), len(options))
+		for i := m.offset; i < end; i++ {
+			option := options[i]
+			line := fmt.Sprintf("%-32s %s.conf", option.Title, option.Name)
+			if option.Name == m.current[m.cursor] {
+				line += "  ● current"
+			}
+			if i == m.choice {
+				result.WriteString(selectedStyle.Render("▶ " + line))
+			} else {
+				result.WriteString(unselectedStyle.Render("  " + line))
+			}
+			result.WriteString("\n")
+		}
+		if m.err != nil {
+			result.WriteString("\n")
+			result.WriteString(errorStyle.Render(m.err.Error()))
+			result.WriteString("\n")
+		}
+		result.WriteString("\nUse ↑↓ to navigate, ENTER to choose, ESC to go back")
+		return result.String()
+	}
+
+	result.WriteString(titleStyle.Render("🎨 Hyprland Variants"))
+	result.WriteString("\n")
+	result.WriteString(descriptionStyle.Render("Each part of the Hyprland config in ~/" + hyprConfDir + " comes in several variants."))
+	result.WriteString("\n\n")
+
+	for i, group := range m.groups {
+		name := m.profile.Variant(group.Dir)
+		title := name
+		if j := indexOfVariant(m.options[i], name); j >= 0 {
+			title = m.options[i][j].Title
+		}
+		// Many files share the name of the one they were copied from
+		line := fmt.Sprintf("%-14s %s (%s.conf)", group.Label, title, name)
+		if m.current[i] == "" {
+			line += "  not set in $HOME"
+		}
+		if i == m.cursor {
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		} else {
+			result.WriteString(unselectedStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	if m.message != "" {
+		result.WriteString("\n")
+		result.WriteString(successStyle.Render(m.message))
+		result.WriteString("\n")
+	}
+	result.WriteString("\nUse ↑↓ to navigate, ENTER to pick a variant, 'q' to quit")
+	return result.String()
+}
+
+// variantsCommand implements `dotfiles-installer variants`.
+func variantsCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: dotfiles-installer variants")
+	}
+
+	source, err := filepath.Abs(dotfilesSourceDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	prof, err := loadProfile()
+	if err != nil {
+		return err
+	}
+	m, err := newVariantsModel(source, home, prof)
+	if err != nil {
+		return err
+	}
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
@@ -0,0 +1,698 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// waybarConfig is the Waybar config, relative to $HOME.
+const waybarConfig = ".config/waybar/config.jsonc"
+
+// waybarSections are the arrays placing the modules on the bar.
+var waybarSections = []string{"modules-left", "modules-center", "modules-right"}
+
+// waybarModuleCommands are the commands the built-in modules need, by type.
+var waybarModuleCommands = map[string]string{
+	"bluetooth": "bluetoothctl",
+}
+
+var (
+	waybarSectionStart = regexp.MustCompile(`^\s*"(modules-(?:left|center|right))"\s*:\s*\[\s*(//.*)?$`)
+	waybarSectionEnd   = regexp.MustCompile(`^\s*\]\s*,?\s*(//.*)?$`)
+	// waybarEntryLine is a module of a section, commented out or not, with
+	// an optional trailing comment
+	waybarEntryLine = regexp.MustCompile(`^(\s*)(//\s*)?"([^"\\]+)"\s*,?\s*(//.*)?$`)
+)
+
+// waybarEntry is a module placed on the bar.
+type waybarEntry struct {
+	Name string
+	// Enabled is unset for the modules commented out
+	Enabled bool
+	Comment string
+	// commentAt is where the comment starts, from the opening quote
+	commentAt int
+}
+
+// waybarSection is one of the modules-* arrays. Its lines are rewritten in
+// place: the entries move between the lines holding one, and blank lines
+// and comments stay where they are.
+type waybarSection struct {
+	Name string
+	// start and end are the lines of the brackets
+	start, end int
+	// slots are the lines holding an entry
+	slots   []int
+	indent  string
+	Entries []waybarEntry
+}
+
+// waybarLayout is config.jsonc as lines, with the sections found in them.
+type waybarLayout struct {
+	lines    []string
+	Sections []waybarSection
+	// Modules are the module definitions, by name
+	Modules map[string]json.RawMessage
+}
+
+// stripJSONC blanks out the comments and trailing commas of JSONC, keeping
+// the offsets of everything else.
+func stripJSONC(data []byte) []byte {
+	out := bytes.Clone(data)
+	inString := false
+	// comma may be a trailing comma, until something else than a space or
+	// comment follows it
+	comma := -1
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString, comma = true, -1
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := len(out)
+			if j := bytes.Index(out[i+2:], []byte("*/")); j >= 0 {
+				end = i + 2 + j + 2
+			}
+			for ; i < end; i++ {
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+			i--
+		case c == ',':
+			comma = i
+		case c == '}' || c == ']':
+			if comma >= 0 {
+				out[comma] = ' '
+			}
+			comma = -1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			comma = -1
+		}
+	}
+	return out
+}
+
+// parseWaybarConfig reads the module definitions of a config and the
+// sections placing them, which have to list one module per line.
+func parseWaybarConfig(data []byte) (waybarLayout, error) {
+	layout := waybarLayout{lines: strings.Split(string(data), "\n")}
+	if err := json.Unmarshal(stripJSONC(data), &layout.Modules); err != nil {
+		return layout, fmt.Errorf("parsing the config, which must hold a single bar: %w", err)
+	}
+	for name, value := range layout.Modules {
+		if !bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+			delete(layout.Modules, name)
+		}
+	}
+
+	for i := 0; i < len(layout.lines); i++ {
+		match := waybarSectionStart.FindStringSubmatch(layout.lines[i])
+		if match == nil {
+			continue
+		}
+		section := waybarSection{Name: match[1], start: i}
+		for i++; i < len(layout.lines) && !waybarSectionEnd.MatchString(layout.lines[i]); i++ {
+			line := layout.lines[i]
+			m := waybarEntryLine.FindStringSubmatchIndex(line)
+			if m == nil {
+				if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "//") {
+					continue
+				}
+				return layout, fmt.Errorf("line %d: expected one module per line in %s, got %q", i+1, section.Name, strings.TrimSpace(line))
+			}
+			entry := waybarEntry{Name: line[m[6]:m[7]], Enabled: m[4] < 0}
+			// The opening quote is just before the name
+			quote := m[6] - 1
+			if m[8] >= 0 {
+				entry.Comment, entry.commentAt = line[m[8]:m[9]], m[8]-quote
+			}
+			if len(section.slots) == 0 {
+				section.indent = line[m[2]:m[3]]
+			}
+			section.slots = append(section.slots, i)
+			section.Entries = append(section.Entries, entry)
+		}
+		if i == len(layout.lines) {
+			return layout, fmt.Errorf("%s is never closed", section.Name)
+		}
+		section.end = i
+		if section.indent == "" {
+			start := layout.lines[section.start]
+			section.indent = start[:len(start)-len(strings.TrimLeft(start, " \t"))] + "  "
+		}
+		layout.Sections = append(layout.Sections, section)
+	}
+	if len(layout.Sections) == 0 {
+		return layout, fmt.Errorf("no %s array found", strings.Join(waybarSections, ", "))
+	}
+	return layout, nil
+}
+
+// line renders an entry. Commas are only needed between the modules that
+// are enabled.
+func (s waybarSection) line(entry waybarEntry, comma bool) string {
+	text := `"` + entry.Name + `"`
+	if comma {
+		text += ","
+	}
+	if entry.Comment != "" {
+		text += strings.Repeat(" ", max(entry.commentAt-len(text), 1)) + entry.Comment
+	}
+	if !entry.Enabled {
+		return s.indent + "// " + text
+	}
+	return s.indent + text
+}
+
+// render returns the config with the sections as edited. Entries beyond the
+// lines the section had are added before its closing bracket.
+func (l waybarLayout) render() []byte {
+	slots := make(map[int]string)
+	extra := make(map[int][]string)
+	for _, section := range l.Sections {
+		last := -1
+		for i, entry := range section.Entries {
+			if entry.Enabled {
+				last = i
+			}
+		}
+		for i, entry := range section.Entries {
+			// Commented out modules keep their comma, to be enabled as they are
+			line := section.line(entry, !entry.Enabled || i < last)
+			if i < len(section.slots) {
+				slots[section.slots[i]] = line
+			} else {
+				extra[section.end] = append(extra[section.end], line)
+			}
+		}
+	}
+
+	var lines []string
+	for i, line := range l.lines {
+		lines = append(lines, extra[i]...)
+		if rendered, ok := slots[i]; ok {
+			line = rendered
+		}
+		lines = append(lines, line)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// arrangement returns the modules of each section, as the profile keeps
+// them.
+func (l waybarLayout) arrangement() map[string][]string {
+	arrangement := make(map[string][]string)
+	for _, section := range l.Sections {
+		names := []string{}
+		for _, entry := range section.Entries {
+			if entry.Enabled {
+				names = append(names, entry.Name)
+			} else {
+				names = append(names, "//"+entry.Name)
+			}
+		}
+		arrangement[section.Name] = names
+	}
+	return arrangement
+}
+
+// arrange places the modules as in an arrangement of the profile. The
+// modules of a section the arrangement doesn't list, such as those added to
+// the checkout since, stay at its end. Those it lists that the section no
+// longer has are dropped, unless they were placed from the unused ones.
+func (l *waybarLayout) arrange(arrangement map[string][]string) {
+	for i := range l.Sections {
+		section := &l.Sections[i]
+		names, ok := arrangement[section.Name]
+		if !ok {
+			continue
+		}
+		shipped := make(map[string]waybarEntry)
+		for _, entry := range section.Entries {
+			shipped[entry.Name] = entry
+		}
+		var entries []waybarEntry
+		for _, name := range names {
+			trimmed := strings.TrimPrefix(name, "//")
+			entry, ok := shipped[trimmed]
+			if !ok {
+				if _, defined := l.Modules[trimmed]; !defined || l.placed(trimmed) {
+					continue
+				}
+				entry = waybarEntry{Name: trimmed}
+			}
+			delete(shipped, trimmed)
+			entry.Enabled = trimmed == name
+			entries = append(entries, entry)
+		}
+		for _, entry := range section.Entries {
+			if _, ok := shipped[entry.Name]; ok {
+				entries = append(entries, entry)
+			}
+		}
+		section.Entries = entries
+	}
+}
+
+// applyWaybar places the modules of the shipped Waybar config as arranged
+// in the profile.
+func (p profile) applyWaybar(file *dotfile) error {
+	if file.Path != waybarConfig || len(p.Waybar) == 0 {
+		return nil
+	}
+	base, err := file.content()
+	if err != nil {
+		return err
+	}
+	layout, err := parseWaybarConfig(base)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file.Path, err)
+	}
+	layout.arrange(p.Waybar)
+	file.Rendered = layout.render()
+	return nil
+}
+
+// placed returns whether a module is in one of the sections, even
+// commented out.
+func (l waybarLayout) placed(name string) bool {
+	for _, section := range l.Sections {
+		for _, entry := range section.Entries {
+			if entry.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unused returns the modules defined but in no section, sorted.
+func (l waybarLayout) unused() []string {
+	var names []string
+	for name := range l.Modules {
+		if !l.placed(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// moduleIssues returns what a module needs that won't be there: the
+// definition of a custom module, the scripts it runs, which exists reports
+// on, and the packages of its commands that are neither installed nor
+// planned.
+func (l waybarLayout) moduleIssues(name string, exists func(rel string) bool, planned map[string]bool) []string {
+	definition, ok := l.Modules[name]
+	if !ok {
+		if strings.HasPrefix(name, "custom/") {
+			return []string{"has no definition in the config"}
+		}
+		definition = json.RawMessage("{}")
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(definition, &fields); err != nil {
+		return []string{err.Error()}
+	}
+
+	var commands []string
+	if command, ok := waybarModuleCommands[strings.SplitN(name, "#", 2)[0]]; ok {
+		commands = append(commands, command)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var issues []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		value, ok := fields[key].(string)
+		if !ok || !strings.HasPrefix(key, "exec") && !strings.HasPrefix(key, "on-") {
+			continue
+		}
+		for _, script := range scriptPaths(value) {
+			if !seen[script] && !exists(script) {
+				issues = append(issues, fmt.Sprintf("%s runs %s, which doesn't exist", key, displayPath(script)))
+			}
+			seen[script] = true
+		}
+		commands = append(commands, execCommands(value)...)
+	}
+	for _, command := range commands {
+		if seen[command] {
+			continue
+		}
+		seen[command] = true
+		if pkg, steps, missing := missingPackage(command, planned); missing {
+			issues = append(issues, fmt.Sprintf("needs %s, but %s is neither installed nor selected (%s)", command, pkg, strings.Join(steps, ", ")))
+		}
+	}
+	return issues
+}
+
+// waybarForm enables, disables and reorders the modules of the bar, and
+// adds the modules defined but not placed.
+type waybarForm struct {
+	// path is the config edited, shown is how it is shown. Without a path
+	// the arrangement is saved to the profile instead.
+	path    string
+	shown   string
+	mode    os.FileMode
+	layout  waybarLayout
+	issues  map[string][]string
+	section int
+	cursor  int
+	offset  int
+	changed bool
+	message string
+	err     error
+}
+
+// newWaybarForm loads the config at path. Scripts are looked for below the
+// roots, in order.
+func newWaybarForm(path, shown string, roots []string, planned []string) (waybarForm, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return waybarForm{}, err
+	}
+	f, err := loadWaybarForm(data, shown, roots, planned)
+	f.path = path
+	if info, err := os.Stat(path); err == nil {
+		f.mode = info.Mode().Perm()
+	}
+	return f, err
+}
+
+// loadWaybarForm edits the arrangement of a config in the profile.
+func loadWaybarForm(data []byte, shown string, roots []string, planned []string) (waybarForm, error) {
+	f := waybarForm{shown: shown, mode: 0644, issues: make(map[string][]string)}
+	var err error
+	if f.layout, err = parseWaybarConfig(data); err != nil {
+		return f, fmt.Errorf("%s: %w", shown, err)
+	}
+
+	exists := func(rel string) bool {
+		for _, root := range roots {
+			if _, err := os.Stat(filepath.Join(root, rel)); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	plannedSet := make(map[string]bool)
+	for _, pkg := range planned {
+		plannedSet[pkg] = true
+	}
+	names := f.layout.unused()
+	for _, section := range f.layout.Sections {
+		for _, entry := range section.Entries {
+			names = append(names, entry.Name)
+		}
+	}
+	for _, name := range names {
+		if issues := f.layout.moduleIssues(name, exists, plannedSet); len(issues) > 0 {
+			f.issues[name] = issues
+		}
+	}
+	return f, nil
+}
+
+// rows returns the modules of the section, then the unused ones.
+func (f waybarForm) rows() (entries []waybarEntry, unused []string) {
+	return f.layout.Sections[f.section].Entries, f.layout.unused()
+}
+
+// update handles keys on the Waybar screen. It returns done when the screen
+// is left, after saving the changes.
+func (f waybarForm) update(msg tea.KeyMsg, page int) (waybarForm, bool, tea.Cmd) {
+	entries, unused := f.rows()
+	count := len(entries) + len(unused)
+	section := &f.layout.Sections[f.section]
+
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return f, true, tea.Quit
+	case "tab", "right", "l":
+		f.section, f.cursor, f.offset = (f.section+1)%len(f.layout.Sections), 0, 0
+		return f, false, nil
+	case "shift+tab", "left", "h":
+		f.section, f.cursor, f.offset = (f.section-1+len(f.layout.Sections))%len(f.layout.Sections), 0, 0
+		return f, false, nil
+	case "up", "k":
+		f.cursor = max(f.cursor-1, 0)
+	case "down", "j":
+		f.cursor = max(min(f.cursor+1, count-1), 0)
+	case "shift+up", "K":
+		if f.cursor > 0 && f.cursor < len(entries) {
+			section.Entries[f.cursor-1], section.Entries[f.cursor] = section.Entries[f.cursor], section.Entries[f.cursor-1]
+			f.cursor--
+			f.changed = true
+		}
+	case "shift+down", "J":
+		if f.cursor+1 < len(entries) {
+			section.Entries[f.cursor+1], section.Entries[f.cursor] = section.Entries[f.cursor], section.Entries[f.cursor+1]
+			f.cursor++
+			f.changed = true
+		}
+	case " ", "space", "enter":
+		switch {
+		case f.cursor < len(entries):
+			section.Entries[f.cursor].Enabled = !section.Entries[f.cursor].Enabled
+		case f.cursor < count:
+			// Placing a module moves it from the unused ones to the end of
+			// the section
+			section.Entries = append(section.Entries, waybarEntry{Name: unused[f.cursor-len(entries)], Enabled: true})
+			f.cursor = len(section.Entries) - 1
+		default:
+			return f, false, nil
+		}
+		f.changed = true
+	case "s":
+		f.message, f.err = f.save()
+	case "esc":
+		if f.message, f.err = f.save(); f.err == nil {
+			return f, true, nil
+		}
+	}
+	if f.cursor < f.offset {
+		f.offset = f.cursor
+	} else if f.cursor >= f.offset+page {
+		f.offset = f.cursor - page + 1
+	}
+	return f, false, nil
+}
+
+// save writes the config, or saves the arrangement to the profile, if it
+// was changed.
+func (f *waybarForm) save() (string, error) {
+	if !f.changed {
+		return "", nil
+	}
+	if f.path == "" {
+		prof, err := loadProfile()
+		if err != nil {
+			return "", err
+		}
+		prof.Waybar = f.layout.arrangement()
+		if err := prof.save(); err != nil {
+			return "", err
+		}
+		f.changed = false
+		return "Saved to the profile, the config is written with the dotfiles", nil
+	}
+	if err := writeFileAtomic(f.path, f.layout.render(), f.mode); err != nil {
+		return "", err
+	}
+	// The slots are the lines as now written
+	layout, err := parseWaybarConfig(f.layout.render())
+	if err != nil {
+		return "", err
+	}
+	f.layout, f.changed = layout, false
+	return "✅ Saved " + f.shown + ", reload Waybar with SUPER + SHIFT + B", nil
+}
+
+func (f waybarForm) view(page int) string {
+	var result strings.Builder
+	result.WriteString(titleStyle.Render("📊 Waybar Modules"))
+	result.WriteString("\n")
+	result.WriteString(descriptionStyle.Render(f.shown))
+	result.WriteString("\n\n")
+
+	var tabs []string
+	for i, section := range f.layout.Sections {
+		if i == f.section {
+			tabs = append(tabs, tabActiveStyle.Render(section.Name))
+		} else {
+			tabs = append(tabs, tabInactiveStyle.Render(section.Name))
+		}
+	}
+	result.WriteString(strings.Join(tabs, ""))
+	result.WriteString("\n\n")
+
+	entries, unused := f.rows()
+	end := min(f.offset+page, len(entries)+len(unused))
+	for i := f.offset; i < end; i++ {
+		var line string
+		var name string
+		if i < len(entries) {
+			entry := entries[i]
+			name = entry.Name
+			box := "☑"
+			if !entry.Enabled {
+				box = "☐"
+			}
+			line = fmt.Sprintf("%s %-24s %s", box, entry.Name, strings.TrimSpace(strings.TrimPrefix(entry.Comment, "//")))
+		} else {
+			name = unused[i-len(entries)]
+			line = fmt.Sprintf("+ %-24s not placed", name)
+		}
+		if len(f.issues[name]) > 0 {
+			line += "  ⚠"
+		}
+
+		switch {
+		case i == f.cursor:
+			result.WriteString(selectedStyle.Render("▶ " + line))
+		case len(f.issues[name]) > 0:
+			result.WriteString(warningStyle.Render("  " + line))
+		case i >= len(entries):
+			result.WriteString(descriptionStyle.Render("  " + line))
+		default:
+			result.WriteString(unselectedStyle.Render("  " + line))
+		}
+		result.WriteString("\n")
+	}
+
+	name := ""
+	if f.cursor < len(entries) {
+		name = entries[f.cursor].Name
+	} else if f.cursor-len(entries) < len(unused) {
+		name = unused[f.cursor-len(entries)]
+	}
+	for _, issue := range f.issues[name] {
+		result.WriteString("\n")
+		result.WriteString(warningStyle.Render("⚠ " + name + " " + issue))
+	}
+	if len(f.issues[name]) > 0 {
+		result.WriteString("\n")
+	}
+
+	if f.err != nil {
+		result.WriteString("\n")
+		result.WriteString(errorStyle.Render(f.err.Error()))
+		result.WriteString("\n")
+	} else if f.message != "" {
+		result.WriteString("\n")
+		result.WriteString(successStyle.Render(f.message))
+		result.WriteString("\n")
+	}
+	result.WriteString("\nUse ↑↓ to navigate, TAB or ←→ to change the section, SPACE to enable, disable or place a module, SHIFT+↑↓ to move it, 's' to save, ESC to save and go back")
+	return result.String()
+}
+
+// updateWaybarForm handles keys on the Waybar screen of the dotfiles review,
+// which rescans the dotfiles with the arrangement saved to the profile.
+func (m model) updateWaybarForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	form, done, cmd := m.waybar.update(msg, m.listHeight())
+	m.waybar = form
+	if done && cmd == nil {
+		m.editingWaybar = false
+		m.review.profile.Waybar = form.layout.arrangement()
+		m.review = m.review.rescan(m.review.mode)
+	}
+	return m, cmd
+}
+
+// waybarModel is the Waybar screen on its own.
+type waybarModel struct {
+	form   waybarForm
+	height int
+}
+
+func (m waybarModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m waybarModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		form, done, _ := m.form.update(msg, m.listHeight())
+		m.form = form
+		if done {
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m waybarModel) listHeight() int {
+	if m.height == 0 {
+		return 20
+	}
+	return max(m.height-10, 5)
+}
+
+func (m waybarModel) View() string {
+	return m.form.view(m.listHeight())
+}
+
+// waybarCommand implements `dotfiles-installer waybar`, which edits the
+// config in $HOME or, with --dotfiles, the one of the checkout.
+func waybarCommand(args []string) error {
+	dotfiles := false
+	switch {
+	case len(args) == 1 && args[0] == "--dotfiles":
+		dotfiles = true
+	case len(args) > 0:
+		return fmt.Errorf("usage: dotfiles-installer waybar [--dotfiles]")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	path, shown, roots := filepath.Join(home, waybarConfig), "~/"+waybarConfig, []string{home}
+	if dotfiles {
+		source, err := filepath.Abs(dotfilesSourceDir)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(source); err != nil {
+			return fmt.Errorf("run this command from the dotfiles directory: %w", err)
+		}
+		path, shown, roots = filepath.Join(source, waybarConfig), filepath.Join(dotfilesSourceDir, waybarConfig), []string{source, home}
+	}
+
+	form, err := newWaybarForm(path, shown, roots, nil)
+	if err != nil {
+		return err
+	}
+	p := tea.NewProgram(waybarModel{form: form}, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// waybarEntryOf returns the entry of a module in a section of the layout.
+func waybarEntryOf(t *testing.T, l *waybarLayout, section, name string) *waybarEntry {
+	t.Helper()
+	for i := range l.Sections {
+		if l.Sections[i].Name != section {
+			continue
+		}
+		for j := range l.Sections[i].Entries {
+			if l.Sections[i].Entries[j].Name == name {
+				return &l.Sections[i].Entries[j]
+			}
+		}
+	}
+	t.Fatalf("%s has no %s", section, name)
+	return nil
+}
+
+func TestWaybarEdits(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join(dotfilesSourceDir, waybarConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shipped, err := parseWaybarConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		edit func(t *testing.T, l *waybarLayout)
+		// lines are rendered lines expected in this order, want the modules
+		// of the sections changed from the shipped arrangement
+		lines []string
+		want  map[string][]string
+	}{
+		{
+			name: "no edits",
+			edit: func(t *testing.T, l *waybarLayout) {},
+		},
+		{
+			// The last enabled module loses its comma, the commented out one
+			// keeps it and the comment stays aligned
+			name: "last module disabled",
+			edit: func(t *testing.T, l *waybarLayout) {
+				waybarEntryOf(t, l, "modules-right", "custom/power").Enabled = false
+			},
+			lines: []string{
+				`    "custom/leftin2"`,
+				`    // "custom/power",         // power button`,
+				`  ],`,
+			},
+			want: map[string][]string{"modules-right": {
+				"custom/media", "custom/left6", "pulseaudio", "custom/left7", "//backlight",
+				"custom/backlight", "custom/left8", "battery", "custom/leftin2", "//custom/power",
+			}},
+		},
+		{
+			name: "commented out module enabled",
+			edit: func(t *testing.T, l *waybarLayout) {
+				waybarEntryOf(t, l, "modules-center", "cpu").Enabled = true
+			},
+			lines: []string{
+				`    "custom/left4",`,
+				`    "cpu",                  // cpu`,
+				`    "custom/cpu",           // cpu`,
+			},
+			want: map[string][]string{"modules-center": {
+				"custom/paddc", "custom/left2", "custom/cpuinfo", "custom/left3", "memory", "custom/left4", "cpu",
+				"custom/cpu", "custom/leftin1", "custom/left5", "custom/distro", "custom/right2", "custom/rightin1",
+				"idle_inhibitor", "clock#time", "custom/right3", "clock#date", "custom/right4", "custom/wifi",
+				"bluetooth", "custom/update", "custom/right5",
+			}},
+		},
+		{
+			// The modules move between the lines, the blank lines stay
+			name: "reordered",
+			edit: func(t *testing.T, l *waybarLayout) {
+				entries := l.Sections[0].Entries
+				entries[0], entries[5] = entries[5], entries[0]
+			},
+			lines: []string{
+				`  "modules-left": [`,
+				`    "hyprland/window",      // window title`,
+				`    "custom/left1",`,
+				``,
+				`    "hyprland/workspaces",  // workspaces`,
+				`    "custom/right1",`,
+				``,
+				`    "custom/paddw",`,
+				`    "custom/ws"             // window icon`,
+				`  ],`,
+			},
+			want: map[string][]string{"modules-left": {
+				"hyprland/window", "custom/left1", "hyprland/workspaces", "custom/right1", "custom/paddw", "custom/ws",
+			}},
+		},
+		{
+			// A module the checkout no longer has is dropped, those it
+			// added since stay at the end
+			name: "profile arrangement",
+			edit: func(t *testing.T, l *waybarLayout) {
+				l.arrange(map[string][]string{
+					"modules-left": {"custom/old", "custom/paddw", "hyprland/window", "//custom/gone", "custom/ws", "custom/left1", "hyprland/workspaces"},
+				})
+			},
+			lines: []string{
+				`    "custom/paddw",`,
+				`    "hyprland/window",      // window title`,
+				``,
+				`    "custom/ws",            // window icon`,
+				`    "custom/left1",`,
+				``,
+				`    "hyprland/workspaces",  // workspaces`,
+				`    "custom/right1"`,
+				`  ],`,
+			},
+			want: map[string][]string{"modules-left": {
+				"custom/paddw", "hyprland/window", "custom/ws", "custom/left1", "hyprland/workspaces", "custom/right1",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := parseWaybarConfig(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(t, &layout)
+			rendered := layout.render()
+			if tt.lines == nil && !bytes.Equal(rendered, data) {
+				t.Fatalf("render() changed the config without edits")
+			}
+			if !strings.Contains(string(rendered), strings.Join(tt.lines, "\n")) {
+				t.Errorf("render() doesn't have the lines\n%s\ngot\n%s", strings.Join(tt.lines, "\n"), rendered)
+			}
+
+			// The rendered config parses again into the edited arrangement
+			parsed, err := parseWaybarConfig(rendered)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := shipped.arrangement()
+			for section, names := range tt.want {
+				want[section] = names
+			}
+			if got := parsed.arrangement(); !reflect.DeepEqual(got, want) {
+				t.Errorf("arrangement() = %v, want %v", got, want)
+			}
+			if len(parsed.lines) != len(shipped.lines) {
+				t.Errorf("got %d lines, want %d", len(parsed.lines), len(shipped.lines))
+			}
+		})
+	}
+}